@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jwiklund/todo/view"
+)
+
+// todo [-v][-r <repo>] comment <id> <text>...
+func commentCmd(t view.Todo, opts map[string]interface{}) {
+	text := strings.Join(opts["<text>"].([]string), " ")
+	if err := t.Comment(opts["<id>"].(string), text); err != nil {
+		mainLog.Error("Could not comment ", err.Error())
+		mainLog.Debugf("%+v", err)
+		exitCode = 1
+	}
+}
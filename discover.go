@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jwiklund/todo/util"
+)
+
+const (
+	projectConfig = ".todo.conf"
+	projectRepo   = ".todo.db"
+	projectState  = ".todo.state"
+)
+
+// discover walk up from dir looking for a project list, like git looks for
+// .git, return the project directory and the file found there or "" if none
+// was found before reaching home (or root)
+func discover(dir string) (string, string) {
+	home := filepath.Clean(util.Expand("~/"))
+	dir = filepath.Clean(dir)
+	for {
+		if dir == home {
+			return "", ""
+		}
+		for _, name := range []string{projectConfig, projectRepo} {
+			if stat, err := os.Stat(filepath.Join(dir, name)); err == nil && !stat.IsDir() {
+				return dir, name
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// projectDefaults keep project repo and state in the project directory
+func projectDefaults(c config, dir string) config {
+	if c.Repo == "" {
+		c.Repo = "sqlite://" + filepath.Join(dir, projectRepo)
+	} else {
+		c.Repo = resolveRepo(c.Repo, dir)
+	}
+	for name, uri := range c.Repos {
+		c.Repos[name] = resolveRepo(uri, dir)
+	}
+	if c.State == "" {
+		c.State = filepath.Join(dir, projectState)
+	}
+	return c
+}
+
+// resolveRepo make a relative repo path relative to dir
+func resolveRepo(uri, dir string) string {
+	t := ""
+	p := uri
+	if indx := strings.Index(uri, "://"); indx != -1 {
+		t = uri[0 : indx+3]
+		p = uri[indx+3:]
+	}
+	if strings.HasPrefix(p, "~/") || filepath.IsAbs(p) {
+		return uri
+	}
+	return t + filepath.Join(dir, p)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscover(t *testing.T) {
+	root, err := ioutil.TempDir("", "discover")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+	sub := filepath.Join(root, "a", "b")
+	os.MkdirAll(sub, 0770)
+
+	dir, _ := discover(sub)
+	assert.Equal(t, "", dir)
+
+	ioutil.WriteFile(filepath.Join(root, "a", projectRepo), nil, 0660)
+	dir, name := discover(sub)
+	assert.Equal(t, filepath.Join(root, "a"), dir)
+	assert.Equal(t, projectRepo, name)
+
+	ioutil.WriteFile(filepath.Join(sub, projectConfig), nil, 0660)
+	dir, name = discover(sub)
+	assert.Equal(t, sub, dir)
+	assert.Equal(t, projectConfig, name)
+}
+
+func TestProjectDefaults(t *testing.T) {
+	c := projectDefaults(config{}, "/p")
+	assert.Equal(t, "sqlite:///p/.todo.db", c.Repo)
+	assert.Equal(t, "/p/.todo.state", c.State)
+
+	c = projectDefaults(config{Repo: "sqlite://db/todo.db"}, "/p")
+	assert.Equal(t, "sqlite:///p/db/todo.db", c.Repo)
+
+	c = projectDefaults(config{Repo: "sqlite://~/todo.db"}, "/p")
+	assert.Equal(t, "sqlite://~/todo.db", c.Repo)
+}
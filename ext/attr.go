@@ -8,8 +8,8 @@ import (
 func MapExternal(external string, tasks []todo.Task) map[string]string {
 	res := map[string]string{}
 	for _, t := range tasks {
-		if attr, ok := t.Attr[external+".id"]; ok {
-			res[attr] = t.ID
+		if l, ok := t.Link(external); ok && l.ID != "" {
+			res[l.ID] = t.ID
 		}
 	}
 	return res
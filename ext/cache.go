@@ -0,0 +1,112 @@
+package ext
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jwiklund/todo/util"
+	"github.com/pkg/errors"
+)
+
+// ErrNotCached nothing was cached
+var ErrNotCached = errors.New("Not cached")
+
+// Cache a snapshot of what an external last fetched, kept on disk so that it
+// can be used when the external can not be reached. Configured as
+//
+//	cache = "false"           # no cache
+//	cache_dir = "~/.cache/todo"
+type Cache struct {
+	path string
+}
+
+// NewCache the cache of external id at uri, in cache_dir or the user cache
+// directory
+func NewCache(id, uri string, extra map[string]string) (Cache, error) {
+	if value, ok := extra["cache"]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return Cache{}, errors.Wrap(err, "Invalid cache")
+		}
+		if !enabled {
+			return Cache{}, nil
+		}
+	}
+	dir := expand(extra["cache_dir"])
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			extLog.Debugf("No cache of %s: %v", id, err)
+			return Cache{}, nil
+		}
+		dir = filepath.Join(userDir, "todo")
+	}
+	// the same external id may be used by several lists
+	sum := sha1.Sum([]byte(uri))
+	return Cache{filepath.Join(dir, id+"-"+hex.EncodeToString(sum[:4])+".json")}, nil
+}
+
+type cached struct {
+	Saved time.Time
+	Data  json.RawMessage
+}
+
+// Save v as the snapshot
+func (c Cache) Save(v interface{}) error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "Could not encode cache")
+	}
+	bs, err := json.Marshal(cached{time.Now().UTC(), data})
+	if err != nil {
+		return errors.Wrap(err, "Could not encode cache")
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return errors.Wrap(err, "Could not create cache directory")
+	}
+	return errors.Wrap(util.WriteFile(c.path, bs, 0600), "Could not write cache")
+}
+
+// Load the snapshot into v, return when it was saved or ErrNotCached
+func (c Cache) Load(v interface{}) (time.Time, error) {
+	if c.path == "" {
+		return time.Time{}, ErrNotCached
+	}
+	bs, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return time.Time{}, ErrNotCached
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "Could not read cache")
+	}
+	var snapshot cached
+	if err := json.Unmarshal(bs, &snapshot); err != nil {
+		return time.Time{}, errors.Wrap(err, "Could not decode cache")
+	}
+	if err := json.Unmarshal(snapshot.Data, v); err != nil {
+		return time.Time{}, errors.Wrap(err, "Could not decode cache")
+	}
+	return snapshot.Saved, nil
+}
+
+// Offline true if err is a failure to reach the external, rather than an
+// error response or missing credentials
+func Offline(err error) bool {
+	cause := errors.Cause(err)
+	if u, ok := cause.(*url.Error); ok {
+		cause = u.Err
+	}
+	_, ok := cause.(net.Error)
+	return ok
+}
@@ -0,0 +1,56 @@
+package ext
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-cache")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewCache("jira", "https://jira", map[string]string{"cache_dir": dir})
+	if !assert.Nil(t, err) {
+		return
+	}
+	var loaded map[string]string
+	_, err = c.Load(&loaded)
+	assert.Equal(t, ErrNotCached, err)
+
+	assert.Nil(t, c.Save(map[string]string{"P-1": "issue"}))
+	saved, err := c.Load(&loaded)
+	assert.Nil(t, err)
+	assert.False(t, saved.IsZero())
+	assert.Equal(t, map[string]string{"P-1": "issue"}, loaded)
+
+	other, _ := NewCache("jira", "https://other", map[string]string{"cache_dir": dir})
+	_, err = other.Load(&loaded)
+	assert.Equal(t, ErrNotCached, err, "cached per uri")
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c, err := NewCache("jira", "https://jira", map[string]string{"cache": "false"})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Save("ignored"))
+	_, err = c.Load(new(string))
+	assert.Equal(t, ErrNotCached, err)
+
+	_, err = NewCache("jira", "https://jira", map[string]string{"cache": "maybe"})
+	assert.NotNil(t, err)
+}
+
+func TestOffline(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "https://jira", Err: &net.OpError{Op: "dial"}}
+	assert.True(t, Offline(refused))
+	assert.True(t, Offline(errors.Wrap(refused, "Could not list issues")))
+	assert.False(t, Offline(errors.New("401 Unauthorized")))
+	assert.False(t, Offline(&url.Error{Op: "Get", URL: "https://jira", Err: errors.New("no credentials")}))
+}
@@ -0,0 +1,137 @@
+package ext
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+var extLog = logrus.WithField("comp", "ext")
+
+// Capabilities what an external can represent and do
+type Capabilities struct {
+	// States the local states the external represents, others are kept locally
+	States []todo.State
+	// Fields attributes mapped to fields of the external
+	Fields []FieldMap
+	// Mappable true if attributes can be mapped to fields of the external
+	Mappable bool
+	// Create true if local tasks are created in the external
+	Create bool
+	// Delete true if tasks unlinked locally are closed in the external
+	Delete bool
+	// TwoWay true if local changes are written to the external, false if
+	// import only
+	TwoWay bool
+}
+
+// Severity of a diagnostic
+type Severity int
+
+const (
+	// SeverityOK a check that passed
+	SeverityOK Severity = iota
+	// SeverityWarning something that will not work as expected
+	SeverityWarning
+	// SeverityError something that fails
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOK:
+		return "ok"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic a finding of a check, Fix tells how to fix it
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Fix      string
+}
+
+// Checker an external that describes what it supports and checks its config
+type Checker interface {
+	Capabilities() Capabilities
+	// Check config and field mappings, connectivity as well if online
+	Check(online bool) []Diagnostic
+}
+
+// Report of checking an external, Capabilities is nil if the external does
+// not describe them
+type Report struct {
+	External     string
+	Type         string
+	Capabilities *Capabilities
+	Diagnostics  []Diagnostic
+}
+
+// Failed true if any check failed
+func (r Report) Failed() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the externals, or the named external, ordered by name
+func (ext external) Check(name string) ([]Report, error) {
+	ids := ext.ids()
+	if name != "" {
+		if _, ok := ext.externals[name]; !ok {
+			return nil, errors.Errorf("external %s does not exist", name)
+		}
+		ids = []string{name}
+	}
+
+	var reports []Report
+	for _, id := range ids {
+		reports = append(reports, check(ext.configs[id], ext.externals[id], true))
+	}
+	return reports, nil
+}
+
+// check an external, the config is checked whether the external is a
+// Checker or not
+func check(config ExternalConfig, e External, online bool) Report {
+	report := Report{External: config.ID, Type: config.Type}
+	maps, err := FieldMaps(config.Extra)
+	if err != nil {
+		report.Diagnostics = append(report.Diagnostics, Diagnostic{SeverityError, err.Error(),
+			"see Field mapping in the README"})
+	}
+	checker, ok := e.(Checker)
+	if !ok {
+		report.Diagnostics = append(report.Diagnostics, Diagnostic{SeverityWarning,
+			"capabilities of " + config.Type + " externals are not known", ""})
+		return report
+	}
+	caps := checker.Capabilities()
+	report.Capabilities = &caps
+	if len(maps) > 0 && !caps.Mappable {
+		report.Diagnostics = append(report.Diagnostics, Diagnostic{SeverityWarning,
+			config.Type + " externals have no fields, the field mappings are ignored",
+			"remove the field tables of " + config.ID})
+	}
+	report.Diagnostics = append(report.Diagnostics, checker.Check(online)...)
+	return report
+}
+
+// validate the config of an external without connecting to it, problems are
+// logged
+func validate(config ExternalConfig, e External) {
+	for _, d := range check(config, e, false).Diagnostics {
+		switch d.Severity {
+		case SeverityError:
+			extLog.Warnf("%s: %s, run todo ext check %s", config.ID, d.Message, config.ID)
+		case SeverityWarning:
+			extLog.Debugf("%s: %s", config.ID, d.Message)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package ext
+
+import (
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// Commenter an external that takes comments on its tasks
+type Commenter interface {
+	// Comment add a comment to the task linked by link
+	Comment(link todo.Link, body string) error
+}
+
+// Comment the task in each external it is attached to that takes comments,
+// ordered by name, false if there were none
+func (ext external) Comment(task todo.Task, body string) (bool, error) {
+	commented := false
+	for _, id := range ext.ids() {
+		commenter, ok := ext.externals[id].(Commenter)
+		if !ok || !task.Attached(id) {
+			continue
+		}
+		link, _ := task.Link(id)
+		if err := commenter.Comment(link, body); err != nil {
+			return commented, errors.Wrap(err, "Could not comment in "+id)
+		}
+		commented = true
+	}
+	return commented, nil
+}
@@ -0,0 +1,124 @@
+package ext
+
+import (
+	"reflect"
+
+	"github.com/jwiklund/todo/todo"
+)
+
+// Op kind of local change handed to an external
+type Op int
+
+const (
+	// OpCreate a new task
+	OpCreate Op = iota
+	// OpUpdate a changed task
+	OpUpdate
+	// OpDelete a task no longer linked to the external
+	OpDelete
+	// OpRelink a task linked to an external it was not linked to before
+	OpRelink
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpCreate:
+		return "create"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	case OpRelink:
+		return "relink"
+	}
+	return "unknown"
+}
+
+// Delta a local change of a task. Prev is the task as the external last saw
+// it, empty if not known in which case everything counts as changed.
+type Delta struct {
+	Op   Op
+	Prev todo.Task
+	Task todo.Task
+}
+
+// Create a delta for a new task
+func Create(task todo.Task) Delta {
+	return Delta{OpCreate, todo.Task{}, task}
+}
+
+// Update a delta from prev to task, a relink if the linked externals changed
+func Update(prev, task todo.Task) Delta {
+	if !reflect.DeepEqual(prev.Linked(), task.Linked()) {
+		return Delta{OpRelink, prev, task}
+	}
+	return Delta{OpUpdate, prev, task}
+}
+
+// For the delta as seen by external: a relink is a create for a new link and
+// a delete for a removed link. False if the task is not linked to external or
+// was detached from it.
+func (d Delta) For(external string) (Delta, bool) {
+	if l, ok := d.Task.Link(external); ok && l.Detached() {
+		return d, false
+	}
+	linked := d.Task.Attached(external)
+	wasLinked := d.Prev.Attached(external)
+	switch {
+	case d.Op == OpCreate && linked:
+		return d, true
+	case d.Op == OpDelete && (linked || wasLinked):
+		return d, true
+	case linked && !wasLinked && d.Known():
+		return Delta{OpRelink, d.Prev, d.Task}, true
+	case !linked && wasLinked:
+		return Delta{OpDelete, d.Prev, d.Task}, true
+	case linked:
+		return Delta{OpUpdate, d.Prev, d.Task}, true
+	}
+	return d, false
+}
+
+// Known true if the previous task is known
+func (d Delta) Known() bool {
+	return d.Prev.ID != "" || d.Prev.Message != ""
+}
+
+// Changed true if field (message, state or an attribute) changed
+func (d Delta) Changed(field string) bool {
+	if !d.Known() {
+		return true
+	}
+	switch field {
+	case "message":
+		return d.Prev.Message != d.Task.Message
+	case "state":
+		return d.Prev.State != d.Task.State
+	}
+	return d.Prev.Attr[field] != d.Task.Attr[field]
+}
+
+// TaskExternal an external handling whole tasks, the contract before deltas
+type TaskExternal interface {
+	Handle(task todo.Task) (todo.Task, error)
+	Sync(r todo.RepoBegin, dryRun bool) (Plan, error)
+	Apply(r todo.RepoBegin, plan Plan) error
+	Close() error
+}
+
+// Adapt a TaskExternal to an External, it gets the new task of creates and
+// updates
+func Adapt(e TaskExternal) External {
+	return adapted{e}
+}
+
+type adapted struct {
+	TaskExternal
+}
+
+func (a adapted) Handle(d Delta) (todo.Task, error) {
+	if d.Op == OpDelete {
+		return d.Task, nil
+	}
+	return a.TaskExternal.Handle(d.Task)
+}
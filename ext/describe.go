@@ -0,0 +1,46 @@
+package ext
+
+import (
+	"time"
+
+	"github.com/jwiklund/todo/todo"
+)
+
+// Description of a task as an external has it, Cached is set if it was read
+// from the cache
+type Description struct {
+	External string
+	ID       string
+	// Fields by name, such as status
+	Fields map[string]string
+	Cached *time.Time `json:",omitempty"`
+}
+
+// Describer an external that describes its tasks
+type Describer interface {
+	// Describe the task linked by link
+	Describe(link todo.Link) (Description, error)
+}
+
+// Describe the task as each external it is attached to that describes its
+// tasks has it, ordered by name. Externals failing to describe it are logged.
+func (ext external) Describe(task todo.Task) []Description {
+	var res []Description
+	for _, id := range task.Linked() {
+		e, ok := ext.externals[id]
+		describer, describes := e.(Describer)
+		if !ok || !describes || !task.Attached(id) {
+			continue
+		}
+		link, _ := task.Link(id)
+		d, err := describer.Describe(link)
+		if err != nil {
+			extLog.Warnf("Could not describe %s in %s: %v", task.ID, id, err)
+			extLog.Debugf("%+v", err)
+			continue
+		}
+		d.External = id
+		res = append(res, d)
+	}
+	return res
+}
@@ -1,22 +1,36 @@
 package ext
 
 import (
+	"sort"
+
 	"github.com/jwiklund/todo/todo"
 	"github.com/pkg/errors"
 )
 
 // External (single) storage interface
 type External interface {
-	Handle(task todo.Task) (todo.Task, error)
-	Sync(r todo.RepoBegin, dryRun bool) error
+	// Handle push a local change, return the task with any external attributes
+	Handle(d Delta) (todo.Task, error)
+	Sync(r todo.RepoBegin, dryRun bool) (Plan, error)
+	Apply(r todo.RepoBegin, plan Plan) error
 	Close() error
 }
 
 // Externals storage interface
 type Externals interface {
-	Handle(task todo.Task) (todo.Task, error)
-	SyncAll(r todo.RepoBegin, dryRun bool) error
-	Sync(r todo.RepoBegin, name string, dryRun bool) error
+	Handle(d Delta) (todo.Task, error)
+	SyncAll(r todo.RepoBegin, dryRun bool) []Result
+	Sync(r todo.RepoBegin, name string, dryRun bool) (Plan, error)
+	Apply(r todo.RepoBegin, plans []Plan) error
+	// Check the externals or the named external, connecting to them
+	Check(name string) ([]Report, error)
+	// Comment the task in its externals, false if none takes comments
+	Comment(task todo.Task, body string) (bool, error)
+	// Describe the task as its externals have it
+	Describe(task todo.Task) []Description
+	// ReadOnly the attributes of the task only its externals write, by the
+	// external writing it
+	ReadOnly(task todo.Task) map[string]string
 	Close() error
 }
 
@@ -54,10 +68,13 @@ func configure(configs []ExternalConfig) (external, error) {
 		if err != nil {
 			return ext, err
 		}
+		validate(config, e)
 		if ext.externals == nil {
 			ext.externals = map[string]External{config.ID: e}
+			ext.configs = map[string]ExternalConfig{config.ID: config}
 		} else {
 			ext.externals[config.ID] = e
+			ext.configs[config.ID] = config
 		}
 	}
 
@@ -66,6 +83,7 @@ func configure(configs []ExternalConfig) (external, error) {
 
 type external struct {
 	externals map[string]External
+	configs   map[string]ExternalConfig
 }
 
 func (ext external) Close() error {
@@ -79,31 +97,97 @@ func (ext external) Close() error {
 	return e
 }
 
-func (ext external) Handle(task todo.Task) (todo.Task, error) {
-	for _, external := range ext.externals {
-		mod, err := external.Handle(task)
+// Handle hand each external linked to the task (before or after) the delta
+// as it sees it, ordered by name. If one fails the task is returned with what
+// the externals before it (and the failing one) returned.
+func (ext external) Handle(d Delta) (todo.Task, error) {
+	for _, id := range ext.ids() {
+		delta, ok := d.For(id)
+		if !ok {
+			continue
+		}
+		mod, err := ext.externals[id].Handle(delta)
 		if err != nil {
 			return mod, err
 		}
-		task = mod
+		d.Task = mod
+	}
+	return d.Task, nil
+}
+
+// ids of the externals, sorted
+func (ext external) ids() []string {
+	var ids []string
+	for id := range ext.externals {
+		ids = append(ids, id)
 	}
-	return task, nil
+	sort.Strings(ids)
+	return ids
 }
 
-func (ext external) Sync(r todo.RepoBegin, name string, dryRun bool) error {
+func (ext external) Sync(r todo.RepoBegin, name string, dryRun bool) (Plan, error) {
 	if ext, ok := ext.externals[name]; ok {
 		return ext.Sync(r, dryRun)
 	}
-	return errors.Errorf("external %s does not exist", name)
+	return Plan{}, errors.Errorf("external %s does not exist", name)
 }
 
-func (ext external) SyncAll(r todo.RepoBegin, dryRun bool) error {
-	for id, ext := range ext.externals {
-		err := ext.Sync(r, dryRun)
+// Result of syncing one external, Err is set if it failed
+type Result struct {
+	Plan Plan
+	Err  error
+}
+
+// SyncAll sync each external ordered by name, a failing external does not
+// stop the others
+func (ext external) SyncAll(r todo.RepoBegin, dryRun bool) []Result {
+	var results []Result
+	for _, id := range ext.ids() {
+		plan, err := ext.externals[id].Sync(r, dryRun)
 		if err != nil {
-			return errors.Wrapf(err, "Failed %s", id)
+			plan.External = id
 		}
+		results = append(results, Result{plan, err})
 	}
 
+	return results
+}
+
+// Apply plans made by a dry run sync in one transaction, fails with
+// ErrorStale if the external or the local tasks changed since. Changes
+// already pushed to the externals are not undone if a later plan fails.
+func (ext external) Apply(r todo.RepoBegin, plans []Plan) error {
+	for _, plan := range plans {
+		if _, ok := ext.externals[plan.External]; !ok {
+			return errors.Errorf("external %s does not exist", plan.External)
+		}
+	}
+	tx, err := r.Begin()
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		if err := ext.externals[plan.External].Apply(nested{tx}, plan); err != nil {
+			tx.Close()
+			return errors.Wrapf(err, "Failed %s", plan.External)
+		}
+	}
+	return tx.Commit()
+}
+
+// nested transaction, committed (or rolled back) by the enclosing one
+type nested struct {
+	todo.RepoCommit
+}
+
+func (n nested) Begin() (todo.RepoCommit, error) {
+	return n, nil
+}
+
+func (n nested) Commit() error {
+	return nil
+}
+
+func (n nested) Close() error {
 	return nil
 }
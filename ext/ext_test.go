@@ -0,0 +1,214 @@
+package ext
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type stub struct {
+	err error
+}
+
+func (s stub) Handle(task todo.Task) (todo.Task, error) { return task, nil }
+func (s stub) Sync(todo.RepoBegin, bool) (Plan, error)  { return Plan{External: "stub"}, s.err }
+func (s stub) Apply(todo.RepoBegin, Plan) error         { return s.err }
+func (s stub) Close() error                             { return nil }
+
+func TestSyncAllContinues(t *testing.T) {
+	e := external{externals: map[string]External{
+		"c": Adapt(stub{}),
+		"a": Adapt(stub{errors.New("down")}),
+		"b": Adapt(stub{}),
+	}}
+
+	results := e.SyncAll(fake.New(), false)
+	if !assert.Equal(t, 3, len(results)) {
+		return
+	}
+	assert.Equal(t, "a", results[0].Plan.External)
+	assert.NotNil(t, results[0].Err)
+	assert.Nil(t, results[1].Err)
+	assert.Nil(t, results[2].Err)
+}
+
+// applying renames the task 1 in its own transaction, as sync does
+type applying struct {
+	stub
+	message string
+}
+
+func (a applying) Apply(r todo.RepoBegin, plan Plan) error {
+	tx, err := r.Begin()
+	if err != nil {
+		return err
+	}
+	task, err := tx.Get("1")
+	if err != nil {
+		tx.Close()
+		return err
+	}
+	task.Message = a.message
+	if err := tx.Update(task); err != nil {
+		tx.Close()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return a.err
+}
+
+func TestApplyOneTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ext")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	r, err := todo.RepoFromPath(filepath.Join(dir, "todo.db"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer r.Close()
+	r.Add("message", nil)
+
+	e := external{externals: map[string]External{
+		"a": Adapt(applying{message: "a"}),
+		"b": Adapt(applying{stub{errors.New("stale")}, "b"}),
+	}}
+	assert.NotNil(t, e.Apply(r, []Plan{{External: "a"}, {External: "b"}}))
+	task, _ := r.Get("1")
+	assert.Equal(t, "message", task.Message, "a is not committed when b fails")
+
+	assert.Nil(t, e.Apply(r, []Plan{{External: "a"}}))
+	task, _ = r.Get("1")
+	assert.Equal(t, "a", task.Message)
+}
+
+func TestDelta(t *testing.T) {
+	prev := todo.Task{ID: "1", Message: "m", Links: map[string]todo.Link{"a": {ID: "A-1"}}}
+	task := todo.Task{ID: "1", Message: "m", State: todo.StateDone, Links: prev.Links}
+
+	d := Update(prev, task)
+	assert.Equal(t, OpUpdate, d.Op)
+	assert.False(t, d.Changed("message"))
+	assert.True(t, d.Changed("state"))
+
+	task.SetLink("b", todo.Link{})
+	d = Update(prev, task)
+	assert.Equal(t, OpRelink, d.Op)
+	assert.True(t, Create(task).Changed("message"))
+
+	a, ok := d.For("a")
+	assert.True(t, ok)
+	assert.Equal(t, OpUpdate, a.Op)
+	b, _ := d.For("b")
+	assert.Equal(t, OpRelink, b.Op)
+	_, ok = d.For("c")
+	assert.False(t, ok)
+
+	task.Unlink("a")
+	a, _ = Update(prev, task).For("a")
+	assert.Equal(t, OpDelete, a.Op)
+}
+
+func TestFieldMaps(t *testing.T) {
+	maps, err := FieldMaps(map[string]string{
+		"project":             "P",
+		"field.prio.remote":   "priority",
+		"field.prio.values.1": "High",
+		"field.prio.values.2": "Low",
+		"field.due.remote":    "duedate",
+		"field.due.direction": "push",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []FieldMap{
+		{Local: "due", Remote: "duedate", Direction: DirectionPush},
+		{Local: "prio", Remote: "priority", Direction: DirectionBoth, Values: map[string]string{"1": "High", "2": "Low"}},
+	}, maps)
+	assert.False(t, maps[0].Pull())
+	remote, ok := maps[1].ToRemote("1")
+	assert.True(t, ok)
+	assert.Equal(t, "High", remote)
+	_, ok = maps[1].ToRemote("3")
+	assert.False(t, ok)
+	local, _ := maps[1].ToLocal("Low")
+	assert.Equal(t, "2", local)
+
+	_, err = FieldMaps(map[string]string{"field.prio.direction": "both"})
+	assert.NotNil(t, err)
+	_, err = FieldMaps(map[string]string{"field.prio.remote": "priority", "field.prio.direction": "up"})
+	assert.NotNil(t, err)
+}
+
+func TestFieldRanges(t *testing.T) {
+	maps, err := FieldMaps(map[string]string{
+		"field.prio.remote":      "priority",
+		"field.prio.ranges":      "true",
+		"field.prio.values.100":  "High",
+		"field.prio.values.1000": "Medium",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	prio := maps[0]
+	assert.True(t, prio.Ranges)
+	for value, expected := range map[string]string{"1": "High", "100": "High", "101": "Medium", "5000": "Medium"} {
+		remote, ok := prio.ToRemote(value)
+		assert.True(t, ok)
+		assert.Equal(t, expected, remote, value)
+	}
+	_, ok := prio.ToRemote("high")
+	assert.False(t, ok)
+	assert.Equal(t, "100", prio.Normalize("10"))
+	assert.Equal(t, "high", prio.Normalize("high"))
+
+	_, err = FieldMaps(map[string]string{"field.prio.remote": "priority", "field.prio.ranges": "maybe"})
+	assert.NotNil(t, err)
+}
+
+type checked struct {
+	External
+}
+
+func (c checked) Capabilities() Capabilities { return Capabilities{Create: true} }
+func (c checked) Check(online bool) []Diagnostic {
+	return []Diagnostic{{Severity: SeverityError, Message: "down"}}
+}
+
+func TestCheck(t *testing.T) {
+	e := external{
+		externals: map[string]External{
+			"a": Adapt(stub{}),
+			"b": checked{Adapt(stub{})},
+		},
+		configs: map[string]ExternalConfig{
+			"a": {ID: "a", Type: "stub"},
+			"b": {ID: "b", Type: "checked", Extra: map[string]string{"field.prio.remote": "priority"}},
+		},
+	}
+
+	reports, err := e.Check("")
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(reports)) {
+		return
+	}
+	assert.Nil(t, reports[0].Capabilities)
+	assert.False(t, reports[0].Failed())
+	assert.True(t, reports[1].Capabilities.Create)
+	assert.True(t, reports[1].Failed())
+	assert.Equal(t, []Diagnostic{
+		{SeverityWarning, "checked externals have no fields, the field mappings are ignored", "remove the field tables of b"},
+		{SeverityError, "down", ""},
+	}, reports[1].Diagnostics)
+
+	_, err = e.Check("c")
+	assert.NotNil(t, err)
+}
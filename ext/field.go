@@ -0,0 +1,200 @@
+package ext
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// Direction a mapped field is synced in
+type Direction string
+
+var (
+	// DirectionBoth local and external changes are synced (default)
+	DirectionBoth = Direction("both")
+	// DirectionPush local changes are written to the external only
+	DirectionPush = Direction("push")
+	// DirectionPull external changes are read only
+	DirectionPull = Direction("pull")
+)
+
+// FieldMap map a local attribute to a field of the external, configured as
+//
+//	[<external>.field.<attribute>]
+//	remote = "<external field>"
+//	direction = "both" | "push" | "pull"
+//
+//	ranges = "true"       # numeric values, see Ranges
+//	read_only = "true"    # pulled, and not changed locally
+//
+//	[<external>.field.<attribute>.values]
+//	<local value> = "<external value>"
+type FieldMap struct {
+	Local     string
+	Remote    string
+	Direction Direction
+	// Values local value -> external value, empty if the values are the same
+	Values map[string]string
+	// Ranges numbers between the local values map to the external value of
+	// the next local value up, those above all to the last
+	Ranges bool
+	// ReadOnly pulled only, and the attribute is not changed locally
+	ReadOnly bool
+}
+
+const fieldPrefix = "field."
+
+// FieldMaps the field mappings of an external config, sorted by local name
+func FieldMaps(extra map[string]string) ([]FieldMap, error) {
+	maps := map[string]*FieldMap{}
+	get := func(local string) *FieldMap {
+		m, ok := maps[local]
+		if !ok {
+			m = &FieldMap{Local: local, Direction: DirectionBoth}
+			maps[local] = m
+		}
+		return m
+	}
+	for key, value := range extra {
+		if !strings.HasPrefix(key, fieldPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(key, fieldPrefix), ".", 3)
+		if len(parts) < 2 {
+			return nil, errors.Errorf("Invalid field mapping %s, should be a table", key)
+		}
+		m := get(parts[0])
+		switch {
+		case parts[1] == "remote" && len(parts) == 2:
+			m.Remote = value
+		case parts[1] == "direction" && len(parts) == 2:
+			switch Direction(value) {
+			case DirectionBoth, DirectionPush, DirectionPull:
+				m.Direction = Direction(value)
+			default:
+				return nil, errors.Errorf("Invalid direction %s of field %s", value, parts[0])
+			}
+		case parts[1] == "ranges" && len(parts) == 2:
+			ranges, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid ranges of field %s", parts[0])
+			}
+			m.Ranges = ranges
+		case parts[1] == "read_only" && len(parts) == 2:
+			readOnly, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid read_only of field %s", parts[0])
+			}
+			m.ReadOnly = readOnly
+		case parts[1] == "values" && len(parts) == 3:
+			if m.Values == nil {
+				m.Values = map[string]string{}
+			}
+			m.Values[parts[2]] = value
+		default:
+			return nil, errors.Errorf("Unknown field mapping key %s", key)
+		}
+	}
+	var res []FieldMap
+	for _, m := range maps {
+		if m.Remote == "" {
+			return nil, errors.Errorf("Field mapping of %s has no remote field", m.Local)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Local < res[j].Local })
+	return res, nil
+}
+
+// Push true if local changes are written to the external
+func (f FieldMap) Push() bool {
+	return f.Direction != DirectionPull && !f.ReadOnly
+}
+
+// Pull true if external changes are read
+func (f FieldMap) Pull() bool {
+	return f.Direction != DirectionPush
+}
+
+// ToRemote the external value of a local value, false if it has none
+func (f FieldMap) ToRemote(value string) (string, bool) {
+	if f.Values == nil || value == "" {
+		return value, true
+	}
+	if remote, ok := f.Values[value]; ok || !f.Ranges {
+		return remote, ok
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", false
+	}
+	var bounds []int
+	for local := range f.Values {
+		if bound, err := strconv.Atoi(local); err == nil {
+			bounds = append(bounds, bound)
+		}
+	}
+	if len(bounds) == 0 {
+		return "", false
+	}
+	sort.Ints(bounds)
+	for _, bound := range bounds {
+		if n <= bound {
+			return f.Values[strconv.Itoa(bound)], true
+		}
+	}
+	return f.Values[strconv.Itoa(bounds[len(bounds)-1])], true
+}
+
+// Normalize a local value as it would come back from the external, such as
+// the local value of its range. Values the external has none for are kept.
+func (f FieldMap) Normalize(value string) string {
+	remote, ok := f.ToRemote(value)
+	if !ok {
+		return value
+	}
+	if local, ok := f.ToLocal(remote); ok {
+		return local
+	}
+	return value
+}
+
+// ToLocal the local value of an external value, false if it has none
+func (f FieldMap) ToLocal(value string) (string, bool) {
+	if f.Values == nil || value == "" {
+		return value, true
+	}
+	var locals []string
+	for local, remote := range f.Values {
+		if remote == value {
+			locals = append(locals, local)
+		}
+	}
+	if len(locals) == 0 {
+		return "", false
+	}
+	// several local values map to the same, use the first
+	sort.Strings(locals)
+	return locals[0], true
+}
+
+// ReadOnly the attributes of task that only the externals it is attached to
+// write, by the external writing it
+func (ext external) ReadOnly(task todo.Task) map[string]string {
+	res := map[string]string{}
+	for _, id := range ext.ids() {
+		checker, ok := ext.externals[id].(Checker)
+		if !ok || !task.Attached(id) {
+			continue
+		}
+		for _, m := range checker.Capabilities().Fields {
+			if m.ReadOnly {
+				res[m.Local] = id
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,307 @@
+package ext
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jwiklund/todo/util"
+	"github.com/pkg/errors"
+)
+
+var httpLog = extLog.WithField("comp", "ext.http")
+
+// HTTPConfig how an external talks to its server, configured as
+//
+//	timeout = "10s"        # for the whole response, per attempt
+//	retries = "3"          # retries of idempotent requests, 0 for none
+//	retry_backoff = "500ms"
+//	proxy = "http://proxy:3128"  # default from HTTPS_PROXY and friends
+//	ca_file = "~/ca.pem"         # trusted in addition to the system CAs
+//	cert_file = "~/client.pem"   # client certificate, with key_file
+//	key_file = "~/client.key"
+type HTTPConfig struct {
+	Timeout  time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Proxy    string
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// maxBackoff longest wait between attempts, Retry-After included
+const maxBackoff = time.Minute
+
+// HTTPConfigFrom the http config of an external
+func HTTPConfigFrom(extra map[string]string) (HTTPConfig, error) {
+	c := HTTPConfig{
+		Timeout:  10 * time.Second,
+		Retries:  3,
+		Backoff:  500 * time.Millisecond,
+		Proxy:    extra["proxy"],
+		CAFile:   expand(extra["ca_file"]),
+		CertFile: expand(extra["cert_file"]),
+		KeyFile:  expand(extra["key_file"]),
+	}
+	var err error
+	if value, ok := extra["timeout"]; ok {
+		if c.Timeout, err = time.ParseDuration(value); err != nil {
+			return c, errors.Wrap(err, "Invalid timeout")
+		}
+	}
+	if value, ok := extra["retries"]; ok {
+		if c.Retries, err = strconv.Atoi(value); err != nil || c.Retries < 0 {
+			return c, errors.New("Invalid retries " + value)
+		}
+	}
+	if value, ok := extra["retry_backoff"]; ok {
+		if c.Backoff, err = time.ParseDuration(value); err != nil {
+			return c, errors.Wrap(err, "Invalid retry_backoff")
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return c, errors.New("cert_file and key_file go together")
+	}
+	return c, nil
+}
+
+// expand ~/path, empty stays empty
+func expand(path string) string {
+	if path == "" {
+		return ""
+	}
+	return util.Expand(path)
+}
+
+// Client a http client of the config, auth (if not nil) wraps the transport
+// to authorize each request. An auth failure is not retried.
+func (c HTTPConfig) Client(auth func(http.RoundTripper) http.RoundTripper) (*http.Client, error) {
+	base, err := c.transport()
+	if err != nil {
+		return nil, err
+	}
+	var rt http.RoundTripper = &retrying{&logging{base}, c.Retries, c.Backoff, c.Timeout}
+	if auth != nil {
+		rt = auth(rt)
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+func (c HTTPConfig) transport() (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid proxy")
+		}
+		proxy = http.ProxyURL(u)
+	}
+	tlsConfig := &tls.Config{}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read ca_file")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates in ca_file " + c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   c.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   c.Timeout,
+		ResponseHeaderTimeout: c.Timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+	}, nil
+}
+
+// sleep between attempts, replaced by tests
+var sleep = time.Sleep
+
+// retrying retry idempotent requests that failed with a network error or a
+// status the server may recover from, each attempt must be done (body read
+// included) within the timeout
+type retrying struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+	timeout time.Duration
+}
+
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		// a body must be replayable
+		return r.Body == nil || r.GetBody != nil
+	}
+	return false
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (t *retrying) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !idempotent(r) {
+		return t.attempt(r)
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := t.attempt(r)
+		if attempt == t.retries || (err == nil && !retryable(res.StatusCode)) {
+			return res, err
+		}
+		wait := t.wait(attempt, res)
+		if err != nil {
+			httpLog.Debugf("%s %s failed, retrying in %s: %v", r.Method, redactURL(r.URL), wait, err)
+		} else {
+			httpLog.Debugf("%s %s got %s, retrying in %s", r.Method, redactURL(r.URL), res.Status, wait)
+			res.Body.Close()
+		}
+		sleep(wait)
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "Could not replay request")
+			}
+			retry := *r
+			retry.Body = body
+			r = &retry
+		}
+	}
+}
+
+// attempt send r once, with a deadline that ends when the response is closed
+func (t *retrying) attempt(r *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(r)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), t.timeout)
+	res, err := t.next.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return res, err
+	}
+	res.Body = &cancelBody{res.Body, cancel}
+	return res, nil
+}
+
+// cancelBody release the deadline of an attempt when its response is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait before the next attempt, what the server asked for in Retry-After or
+// an exponential backoff with jitter
+func (t *retrying) wait(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if after := retryAfter(res.Header.Get("Retry-After")); after > 0 {
+			if after > maxBackoff {
+				return maxBackoff
+			}
+			return after
+		}
+	}
+	wait := t.backoff << uint(attempt)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	// between half and all of it, so that clients do not retry in step
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// retryAfter the delay of a Retry-After header, seconds or a http date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// logging log requests and responses at debug level, without secrets
+type logging struct {
+	next http.RoundTripper
+}
+
+// secretHeaders not logged
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+func redactHeader(header http.Header) http.Header {
+	res := http.Header{}
+	for key, values := range header {
+		if secretHeaders[http.CanonicalHeaderKey(key)] {
+			res[key] = []string{"REDACTED"}
+		} else {
+			res[key] = values
+		}
+	}
+	return res
+}
+
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.User("REDACTED")
+	return redacted.String()
+}
+
+func (l *logging) RoundTrip(r *http.Request) (*http.Response, error) {
+	started := time.Now()
+	httpLog.Debugf("> %s %s %v", r.Method, redactURL(r.URL), redactHeader(r.Header))
+	res, err := l.next.RoundTrip(r)
+	if err != nil {
+		httpLog.Debugf("< %s %s failed after %s: %v", r.Method, redactURL(r.URL), time.Since(started), err)
+		return res, err
+	}
+	httpLog.Debugf("< %s %s %s in %s %v", r.Method, redactURL(r.URL), res.Status, time.Since(started), redactHeader(res.Header))
+	return res, nil
+}
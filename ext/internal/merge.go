@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// Policy resolve a field changed both locally and in the external since last sync
+type Policy string
+
+var (
+	// PolicyRemote keep the external value (default)
+	PolicyRemote = Policy("remote-wins")
+	// PolicyLocal keep the local value and push it to the external
+	PolicyLocal = Policy("local-wins")
+	// PolicyNewest keep the most recently modified value, the external tasks
+	// must have the time they were modified in the modified attribute
+	PolicyNewest = Policy("newest")
+	// PolicyAsk ask on the terminal when the sync is applied
+	PolicyAsk = Policy("ask")
+)
+
+// PolicyFrom parse a conflict policy, empty means remote-wins
+func PolicyFrom(policy string) (Policy, error) {
+	switch Policy(policy) {
+	case "":
+		return PolicyRemote, nil
+	case PolicyRemote, PolicyLocal, PolicyNewest, PolicyAsk:
+		return Policy(policy), nil
+	}
+	return PolicyRemote, errors.New("Invalid conflict policy " + policy)
+}
+
+// Ask resolve a conflict interactively, return true to keep the local value
+var Ask = askStdin
+
+func askStdin(task todo.Task, field, local, remote string) (bool, error) {
+	fmt.Printf("Conflict in %s of (%s) %s\n  local:  %s\n  remote: %s\nKeep local or remote [l/r]? ",
+		field, task.ID, task.Message, local, remote)
+	answer, err := ext.Stdin.ReadString('\n')
+	if err != nil {
+		return false, errors.Wrap(err, "Could not read answer")
+	}
+	return strings.HasPrefix(strings.TrimSpace(answer), "l"), nil
+}
+
+type field struct {
+	name string
+	get  func(todo.Task) string
+	set  func(*todo.Task, string)
+	// pull only, local changes are not pushed
+	pull bool
+}
+
+var fields = []field{
+	{"message",
+		func(t todo.Task) string { return t.Message },
+		func(t *todo.Task, v string) { t.Message = v }, false},
+	{"state",
+		func(t todo.Task) string { return t.State.String() },
+		func(t *todo.Task, v string) { t.State = todo.StateFrom(v) }, false},
+}
+
+// attrField a mapped attribute, empty is the same as missing
+func attrField(name string, pull bool) field {
+	return field{name,
+		func(t todo.Task) string { return t.Attr[name] },
+		func(t *todo.Task, v string) {
+			if v == "" {
+				delete(t.Attr, name)
+				return
+			}
+			if t.Attr == nil {
+				t.Attr = map[string]string{}
+			}
+			t.Attr[name] = v
+		}, pull}
+}
+
+// fields merged with the external, message, state and the attributes mapped
+// to fields of the external that are pulled
+func (o Options) fields() []field {
+	res := fields
+	for _, m := range o.Fields {
+		if m.Pull() {
+			res = append(res, attrField(m.Local, !m.Push()))
+		}
+	}
+	return res
+}
+
+func baseKey(field string) string {
+	return "base." + field
+}
+
+// base the task as it was when last synced with the external, and which
+// fields were known then. Pull only fields have no base, the external wins.
+func (o Options) base(t todo.Task) (todo.Task, map[string]bool) {
+	b := todo.Task{}
+	known := map[string]bool{}
+	link, _ := t.Link(o.ID)
+	for _, f := range o.fields() {
+		if value, ok := link.Meta[baseKey(f.name)]; ok && !f.pull {
+			f.set(&b, value)
+			known[f.name] = true
+		}
+	}
+	return b, known
+}
+
+// setBase remember b as the task last synced with the external, the base of
+// pull only fields (kept before they were left out) is dropped
+func (o Options) setBase(t *todo.Task, b todo.Task) {
+	link, _ := t.Link(o.ID)
+	meta := map[string]string{}
+	for key, value := range link.Meta {
+		meta[key] = value
+	}
+	for _, f := range o.fields() {
+		if f.pull {
+			delete(meta, baseKey(f.name))
+		} else {
+			meta[baseKey(f.name)] = f.get(b)
+		}
+	}
+	link.Meta = meta
+	t.SetLink(o.ID, link)
+}
+
+func copyTask(t todo.Task) todo.Task {
+	c := t
+	c.Attr = map[string]string{}
+	for key, value := range t.Attr {
+		c.Attr[key] = value
+	}
+	return c
+}
+
+// assumeState an external task without state (in a status the external does
+// not map) is assumed to be as it was at last sync, so that the local state is
+// kept and only pushed if changed locally
+func (o Options) assumeState(external, local todo.Task) todo.Task {
+	if external.State != "" {
+		return external
+	}
+	b, known := o.base(local)
+	if !known["state"] {
+		b = local
+	}
+	external.State = o.normalize(b).State
+	return external
+}
+
+// threeWay merge external and local using the base stored at last sync,
+// return the merged local task, if it should be pushed to the external and
+// the conflicts resolved by policy
+func threeWay(opts Options, external, local todo.Task) (todo.Task, bool, []ext.Conflict) {
+	merged := copyTask(local)
+	normalized := opts.normalize(local)
+	b, known := opts.base(local)
+	normalizedBase := opts.normalize(b)
+	push := false
+	var conflicts []ext.Conflict
+	for _, f := range opts.fields() {
+		ev := f.get(external)
+		lv := f.get(local)
+		if ev == f.get(normalized) {
+			// same in both, as far as the external can tell
+			continue
+		}
+		if !known[f.name] || f.pull {
+			if ev == "" && !f.pull {
+				// newly mapped attribute the external has no value for
+				push = true
+				continue
+			}
+			// first sync of the field, the external wins as it always did before
+			f.set(&merged, ev)
+			continue
+		}
+		remoteChanged := ev != f.get(normalizedBase)
+		localChanged := lv != f.get(b)
+		switch {
+		case remoteChanged && !localChanged:
+			f.set(&merged, ev)
+		case !remoteChanged && localChanged:
+			push = true
+		case remoteChanged && localChanged:
+			c := ext.Conflict{Field: f.name, Local: lv, Remote: ev, Kept: ext.KeptRemote}
+			switch {
+			case opts.Policy == PolicyAsk:
+				// remote until asked when the plan is applied
+				c.Kept = ext.KeptAsk
+				f.set(&merged, ev)
+			case opts.resolve(f.name, external, local):
+				c.Kept = ext.KeptLocal
+				push = true
+			default:
+				f.set(&merged, ev)
+			}
+			conflicts = append(conflicts, c)
+		}
+	}
+	opts.setBase(&merged, merged)
+	return merged, push, conflicts
+}
+
+// resolve a conflicting field using the configured policy, true keeps local
+func (o Options) resolve(field string, external, local todo.Task) bool {
+	switch o.Policy {
+	case PolicyLocal:
+		return true
+	case PolicyNewest:
+		lm, lerr := time.Parse(time.RFC3339, local.Attr["modified"])
+		em, eerr := time.Parse(time.RFC3339, external.Attr["modified"])
+		if lerr != nil || eerr != nil {
+			syncLog.Warnf("No modification time for %s, keeping remote %s", local.ID, field)
+			return false
+		}
+		return lm.After(em)
+	}
+	return false
+}
+
+// ask the conflicts of updates planned to be asked, keeping the local value
+// of a field turns the update into a push
+func (o Options) ask(updates []ext.PlanAction) ([]ext.PlanAction, error) {
+	var res []ext.PlanAction
+	for _, up := range updates {
+		conflicts := append([]ext.Conflict(nil), up.Conflicts...)
+		after := copyTask(up.After)
+		for i, c := range conflicts {
+			if c.Kept != ext.KeptAsk {
+				continue
+			}
+			keepLocal, err := Ask(up.Before, c.Field, c.Local, c.Remote)
+			if err != nil {
+				return nil, err
+			}
+			conflicts[i].Kept = ext.KeptRemote
+			if !keepLocal {
+				continue
+			}
+			for _, f := range o.fields() {
+				if f.name == c.Field {
+					f.set(&after, c.Local)
+				}
+			}
+			conflicts[i].Kept = ext.KeptLocal
+			up.Push = true
+			o.setBase(&after, after)
+			up.After = after
+			up.Changes = changes(up.Before, after)
+		}
+		up.Conflicts = conflicts
+		res = append(res, up)
+	}
+	return res, nil
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func synced(message string, state todo.State, baseMessage string) todo.Task {
+	return todo.Task{
+		Message: message,
+		State:   state,
+		Attr:    map[string]string{},
+		Links: map[string]todo.Link{"ext": {Meta: map[string]string{
+			"base.message": baseMessage,
+			"base.state":   "todo",
+		}}},
+	}
+}
+
+func TestThreeWayRemoteChange(t *testing.T) {
+	merged, push, cs := threeWay(Options{ID: "ext"},
+		todo.Task{Message: "remote", State: todo.StateTodo},
+		synced("base", todo.StateTodo, "base"))
+	assert.Equal(t, "remote", merged.Message)
+	assert.Equal(t, "remote", merged.Links["ext"].Meta["base.message"])
+	assert.False(t, push)
+	assert.Equal(t, 0, len(cs))
+}
+
+func TestThreeWayLocalChange(t *testing.T) {
+	merged, push, cs := threeWay(Options{ID: "ext"},
+		todo.Task{Message: "base", State: todo.StateTodo},
+		synced("local", todo.StateTodo, "base"))
+	assert.Equal(t, "local", merged.Message)
+	assert.True(t, push)
+	assert.Equal(t, 0, len(cs))
+}
+
+func TestThreeWayConflict(t *testing.T) {
+	external := todo.Task{Message: "remote", State: todo.StateTodo}
+	local := synced("local", todo.StateTodo, "base")
+
+	merged, push, cs := threeWay(Options{ID: "ext", Policy: PolicyRemote}, external, local)
+	assert.Equal(t, "remote", merged.Message)
+	assert.False(t, push)
+	assert.Equal(t, 1, len(cs))
+
+	merged, push, _ = threeWay(Options{ID: "ext", Policy: PolicyLocal}, external, local)
+	assert.Equal(t, "local", merged.Message)
+	assert.True(t, push)
+
+	external.Attr = map[string]string{"modified": "2017-01-02T00:00:00Z"}
+	local.Attr["modified"] = "2017-01-01T00:00:00Z"
+	merged, _, _ = threeWay(Options{ID: "ext", Policy: PolicyNewest}, external, local)
+	assert.Equal(t, "remote", merged.Message)
+
+	merged, push, cs = threeWay(Options{ID: "ext", Policy: PolicyAsk}, external, local)
+	assert.Equal(t, "remote", merged.Message)
+	assert.False(t, push)
+	assert.Equal(t, ext.KeptAsk, cs[0].Kept)
+}
+
+func TestAskWhenApplied(t *testing.T) {
+	opts := Options{ID: "ext", Policy: PolicyAsk}
+	r := fake.New()
+	task := r.MustAdd("local", nil)
+	task.SetLink("ext", todo.Link{ID: "1", Meta: map[string]string{"base.message": "base", "base.state": "todo"}})
+	r.MustUpdate(task)
+	local, _ := r.List()
+	external := []todo.Task{{Message: "remote", State: todo.StateTodo, Links: map[string]todo.Link{"ext": {ID: "1"}}}}
+	asked := 0
+	Ask = func(task todo.Task, field, l, r string) (bool, error) {
+		asked++
+		return true, nil
+	}
+	defer func() { Ask = askStdin }()
+
+	plan, err := SyncHelper(r, opts, true, external, local)
+	if !assert.Nil(t, err) || !assert.Equal(t, 1, len(plan.Updates)) {
+		return
+	}
+	assert.Equal(t, 0, asked, "asked when applied, not when planned")
+	assert.Equal(t, ext.KeptAsk, plan.Updates[0].Conflicts[0].Kept)
+
+	assert.Nil(t, ApplyHelper(r, opts, plan, external, local))
+	assert.Equal(t, 1, asked)
+	assert.Equal(t, "local", r.MustGet("0").Message)
+	assert.Equal(t, "local", r.MustGet("0").Links["ext"].Meta["base.message"])
+}
+
+func TestPolicyFrom(t *testing.T) {
+	p, err := PolicyFrom("")
+	assert.Nil(t, err)
+	assert.Equal(t, PolicyRemote, p)
+	_, err = PolicyFrom("other")
+	assert.NotNil(t, err)
+}
+
+func TestThreeWayFields(t *testing.T) {
+	opts := Options{ID: "ext", Fields: []ext.FieldMap{
+		{Local: "due", Remote: "duedate", Direction: ext.DirectionBoth},
+		{Local: "prio", Remote: "priority", Direction: ext.DirectionPull},
+		{Local: "tags", Remote: "labels", Direction: ext.DirectionPush},
+	}}
+	local := synced("base", todo.StateTodo, "base")
+	local.Attr = map[string]string{"due": "2017-02-01", "prio": "1", "tags": "a"}
+	local.SetLink("ext", local.Links["ext"].With("base.due", "2017-01-01").With("base.prio", "2"))
+	external := todo.Task{Message: "base", State: todo.StateTodo, Attr: map[string]string{
+		"due": "2017-01-01", "prio": "3",
+	}}
+
+	merged, push, cs := threeWay(opts, external, local)
+	assert.True(t, push)
+	assert.Equal(t, 0, len(cs))
+	assert.Equal(t, map[string]string{"due": "2017-02-01", "prio": "3", "tags": "a"}, merged.Attr)
+	assert.Equal(t, "2017-02-01", merged.Links["ext"].Meta["base.due"])
+	_, ok := merged.Links["ext"].Meta["base.tags"]
+	assert.False(t, ok)
+	_, ok = merged.Links["ext"].Meta["base.prio"]
+	assert.False(t, ok, "pull only fields have no base, one kept before is dropped")
+}
+
+func TestThreeWayUnknownState(t *testing.T) {
+	opts := Options{ID: "ext"}
+	local := synced("base", todo.StateTodo, "base")
+	local.State = todo.StateWaiting
+	local.Links["ext"].Meta["base.state"] = "waiting"
+
+	external := opts.assumeState(todo.Task{Message: "base"}, local)
+	merged, push, _ := threeWay(opts, external, local)
+	assert.Equal(t, todo.StateWaiting, merged.State)
+	assert.False(t, push)
+
+	local.State = todo.StateDone
+	external = opts.assumeState(todo.Task{Message: "base"}, local)
+	assert.Equal(t, todo.StateWaiting, external.State)
+	merged, push, _ = threeWay(opts, external, local)
+	assert.Equal(t, todo.StateDone, merged.State)
+	assert.True(t, push)
+}
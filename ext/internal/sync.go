@@ -1,64 +1,237 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/deckarep/golang-set"
+	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/todo"
 )
 
+var syncLog = logrus.WithField("comp", "ext.sync")
+
 type indexedTasks struct {
 	tasks []todo.Task
 	index map[string]int
 }
 
-// SyncHelper common sync implememntation
-func SyncHelper(r todo.RepoBegin, extID string, dryRun bool, externalCurrent, localCurrent []todo.Task) error {
+// Options external specific sync behaviour
+type Options struct {
+	// ID of the external
+	ID string
+	// Handle push local changes to the external
+	Handle func(ext.Delta) (todo.Task, error)
+	// Normalize return the task as the external would represent it, nil if lossless
+	Normalize func(todo.Task) todo.Task
+	// Policy for fields changed on both sides since last sync
+	Policy Policy
+	// Fields local attributes mapped to fields of the external
+	Fields []ext.FieldMap
+	// Partial the external tasks may be incomplete, local tasks missing
+	// from them are not closed unless listed in Gone
+	Partial bool
+	// Gone external ids of a partial sync that were closed or left the
+	// scope of the external
+	Gone []string
+}
+
+func (o Options) normalize(t todo.Task) todo.Task {
+	if o.Normalize == nil {
+		return t
+	}
+	return o.Normalize(t)
+}
+
+// SyncHelper common sync implememntation, return the plan that was applied
+// (or would be applied if dry run)
+func SyncHelper(r todo.RepoBegin, opts Options, dryRun bool, externalCurrent, localCurrent []todo.Task) (ext.Plan, error) {
+	plan, err := PlanHelper(r, opts, externalCurrent, localCurrent)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	return plan, apply(r, opts, plan)
+}
+
+// ApplyHelper apply a plan made earlier, if nothing changed since
+func ApplyHelper(r todo.RepoBegin, opts Options, plan ext.Plan, externalCurrent, localCurrent []todo.Task) error {
+	if fingerprint(opts.ID, externalCurrent, localCurrent) != plan.Fingerprint {
+		return ext.ErrorStale
+	}
+	for _, action := range plan.Revives {
+		current, err := r.GetByExternal(opts.ID, action.ExternalID)
+		if err != nil || !sameTask(current, action.Before) {
+			return ext.ErrorStale
+		}
+	}
+	for _, action := range plan.Links {
+		current, err := r.Get(action.Before.ID)
+		if err != nil || !sameTask(current, action.Before) {
+			return ext.ErrorStale
+		}
+	}
+	return apply(r, opts, plan)
+}
+
+// PlanHelper compute what a sync would change
+func PlanHelper(r todo.Repo, opts Options, externalCurrent, localCurrent []todo.Task) (ext.Plan, error) {
+	extID := opts.ID
 	external := index(extID, externalCurrent)
 	local := index(extID, localCurrent)
+	detach(extID, external, local)
+	plan := ext.Plan{
+		External:    extID,
+		Fingerprint: fingerprint(extID, externalCurrent, localCurrent),
+	}
 
 	externalIds := external.IDSet()
 	localIds := local.IDSet()
 
 	added := externalIds.Difference(localIds)
 	missing := localIds.Difference(externalIds)
-	updated := updated(external, local)
+	plan.Updates = updated(opts, external, local)
 
-	rev, err := revived(r, extID, external, added)
+	rev, err := revived(r, opts, external, added)
 	if err != nil {
-		return err
+		return plan, err
+	}
+	for _, t := range rev {
+		added.Remove(t.ExternalID)
+	}
+	plan.Revives = rev
+	plan.Adds = adds(opts, external, added)
+	if opts.Partial {
+		gone := mapset.NewThreadUnsafeSet()
+		for _, id := range opts.Gone {
+			gone.Add(id)
+		}
+		syncLog.Debugf("Partial sync of %s, %d missing tasks, %d gone", extID, missing.Cardinality(), gone.Cardinality())
+		missing = missing.Intersect(gone)
 	}
-	for _, r := range rev {
-		added.Remove(r.Attr[extID+".id"])
+	plan.Closes = closes(extID, local, missing)
+
+	for _, actions := range [][]ext.PlanAction{plan.Adds, plan.Closes, plan.Updates, plan.Revives} {
+		sort.Slice(actions, func(i, j int) bool {
+			return actions[i].ExternalID < actions[j].ExternalID
+		})
 	}
+	return plan, nil
+}
 
-	if dryRun {
-		syncLog := logrus.WithField("comp", "ext.sync")
-		syncLog.Infof("DRY RUN EXT %+v", externalCurrent)
-		syncLog.Infof("DRY RUN LOC %+v", localCurrent)
-		syncLog.Info("DRY RUN ", extID, " ADD ", added)
-		syncLog.Info("DRY RUN ", extID, " REM ", missing)
-		syncLog.Info("DRY RUN ", extID, " UPD ", updated)
-		syncLog.Info("DRY RUN ", extID, " REV ", rev)
-		return nil
+// fingerprint the tasks a plan is based on
+func fingerprint(extID string, externalCurrent, localCurrent []todo.Task) string {
+	linked := func(tasks []todo.Task) []todo.Task {
+		var res []todo.Task
+		for _, t := range tasks {
+			if linkID(extID, t) != "" {
+				res = append(res, t)
+			}
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return linkID(extID, res[i]) < linkID(extID, res[j])
+		})
+		return res
 	}
+	bs, _ := json.Marshal([][]todo.Task{linked(externalCurrent), linked(localCurrent)})
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
 
+func sameTask(t1, t2 todo.Task) bool {
+	b1, _ := json.Marshal(t1)
+	b2, _ := json.Marshal(t2)
+	return string(b1) == string(b2)
+}
+
+// linkID the id of t in external extID, empty if not linked or not created yet
+func linkID(extID string, t todo.Task) string {
+	l, _ := t.Link(extID)
+	return l.ID
+}
+
+func newAction(extID string, before, after todo.Task) ext.PlanAction {
+	id := linkID(extID, after)
+	if id == "" {
+		id = linkID(extID, before)
+	}
+	return ext.PlanAction{
+		ExternalID: id,
+		Before:     before,
+		After:      after,
+		Changes:    changes(before, after),
+	}
+}
+
+// changes field level diff between before and after, links are shown as
+// link:<external> with the external id
+func changes(before, after todo.Task) []ext.FieldChange {
+	var res []ext.FieldChange
+	change := Compare(before, after)
+	from := func(field string) string {
+		switch field {
+		case "message":
+			return before.Message
+		case "state":
+			return before.State.String()
+		}
+		return before.Attr[field]
+	}
+	if before.State != after.State {
+		res = append(res, ext.FieldChange{Field: "state", From: from("state"), To: after.State.String()})
+	}
+	for field, value := range change.Added {
+		res = append(res, ext.FieldChange{Field: field, To: value})
+	}
+	for field, value := range change.Modified {
+		res = append(res, ext.FieldChange{Field: field, From: from(field), To: value})
+	}
+	for _, field := range change.Removed {
+		res = append(res, ext.FieldChange{Field: field, From: from(field)})
+	}
+	for _, name := range after.Linked() {
+		if id, was := linkID(name, after), linkID(name, before); id != was {
+			res = append(res, ext.FieldChange{Field: "link:" + name, From: was, To: id})
+		}
+	}
+	for _, name := range before.Linked() {
+		if _, ok := after.Link(name); !ok {
+			res = append(res, ext.FieldChange{Field: "link:" + name, From: linkID(name, before)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Field < res[j].Field })
+	return res
+}
+
+func apply(r todo.RepoBegin, opts Options, plan ext.Plan) error {
+	updates, err := opts.ask(plan.Updates)
+	if err != nil {
+		return err
+	}
+	plan.Updates = updates
 	commitRepo, err := r.Begin()
 	if err != nil {
 		return err
 	}
-	if err := syncAdd(commitRepo, extID, external, added); err != nil {
+	if err := syncAdd(commitRepo, plan.Adds); err != nil {
 		commitRepo.Close()
 		return err
 	}
-	if err := syncRemove(commitRepo, local, missing); err != nil {
+	if err := syncRemove(commitRepo, plan.Closes); err != nil {
 		commitRepo.Close()
 		return err
 	}
-	if err := syncUpdate(commitRepo, external, local, updated); err != nil {
+	if err := syncUpdate(commitRepo, opts, plan.Updates); err != nil {
 		commitRepo.Close()
 		return err
 	}
-	if err := syncRevive(commitRepo, rev); err != nil {
+	if err := syncRevive(commitRepo, plan.Revives); err != nil {
+		commitRepo.Close()
+		return err
+	}
+	if err := syncRevive(commitRepo, plan.Links); err != nil {
 		commitRepo.Close()
 		return err
 	}
@@ -68,13 +241,24 @@ func SyncHelper(r todo.RepoBegin, extID string, dryRun bool, externalCurrent, lo
 func index(extID string, tasks []todo.Task) *indexedTasks {
 	index := map[string]int{}
 	for i, task := range tasks {
-		if a, ok := task.Attr[extID+".id"]; ok {
+		if a := linkID(extID, task); a != "" {
 			index[a] = i
 		}
 	}
 	return &indexedTasks{tasks, index}
 }
 
+// detach drop tasks detached from the external, they are neither imported
+// again nor closed, updated or revived
+func detach(extID string, external, local *indexedTasks) {
+	for id, i := range local.index {
+		if l, _ := local.tasks[i].Link(extID); l.Detached() {
+			delete(local.index, id)
+			delete(external.index, id)
+		}
+	}
+}
+
 func (i *indexedTasks) IDSet() mapset.Set {
 	r := mapset.NewThreadUnsafeSet()
 	for key := range i.index {
@@ -104,36 +288,49 @@ func infileSet(lines [][]byte) mapset.Set {
 	return s
 }
 
-func updated(external, local *indexedTasks) mapset.Set {
-	updated := mapset.NewThreadUnsafeSet()
+// updated three way merge linked tasks, return updates of local tasks
+func updated(opts Options, external, local *indexedTasks) []ext.PlanAction {
+	var updated []ext.PlanAction
 
 	for externalKey, externalIndex := range external.index {
 		if localIndex, ok := local.index[externalKey]; ok {
 			e := external.tasks[externalIndex]
 			l := local.tasks[localIndex]
+			e = opts.assumeState(e, l)
 
-			if e.Message != l.Message || e.State != l.State {
-				updated.Add(externalKey)
+			merged, push, conflicts := threeWay(opts, e, l)
+			if push || !merged.Equal(l) {
+				action := newAction(opts.ID, l, merged)
+				action.Push = push
+				action.Remote = e
+				action.Conflicts = conflicts
+				updated = append(updated, action)
 			}
-
 		}
 	}
 
 	return updated
 }
 
+// merge the external task into local, keeping the local links
 func merge(external, local todo.Task) todo.Task {
-	for key, value := range local.Attr {
-		if _, ok := external.Attr[key]; !ok {
-			external.Attr[key] = value
+	merged := copyTask(local)
+	merged.Message = external.Message
+	if external.State != "" {
+		merged.State = external.State
+	}
+	for key, value := range external.Attr {
+		if key != "modified" {
+			// when the external task was modified, not the local
+			merged.Attr[key] = value
 		}
 	}
-	external.ID = local.ID
-	return external
+	return merged
 }
 
-func revived(r todo.Repo, extID string, external *indexedTasks, missing mapset.Set) ([]todo.Task, error) {
-	var result []todo.Task
+func revived(r todo.Repo, opts Options, external *indexedTasks, missing mapset.Set) ([]ext.PlanAction, error) {
+	var result []ext.PlanAction
+	extID := opts.ID
 
 	for _, removed := range missing.ToSlice() {
 		r, err := r.GetByExternal(extID, removed.(string))
@@ -144,34 +341,57 @@ func revived(r todo.Repo, extID string, external *indexedTasks, missing mapset.S
 			// not found, ignore
 		} else {
 			// found, not revived
-			result = append(result, merge(external.GetByExternal(removed.(string)), r))
+			revived := merge(external.GetByExternal(removed.(string)), r)
+			opts.setBase(&revived, revived)
+			result = append(result, newAction(extID, r, revived))
 		}
 	}
 
 	return result, nil
 }
 
-func syncAdd(r todo.Repo, extID string, external *indexedTasks, added mapset.Set) error {
+func adds(opts Options, external *indexedTasks, added mapset.Set) []ext.PlanAction {
+	var result []ext.PlanAction
+	extID := opts.ID
 	for _, add := range added.ToSlice() {
 		index := external.index[add.(string)]
-		addedMessage := external.tasks[index].Message
-		_, err := r.Add(addedMessage, map[string]string{
-			"external":    extID,
-			extID + ".id": add.(string),
-		})
-		if err != nil {
-			return err
+		e := external.tasks[index]
+		if e.State == "" {
+			// in a status the external does not map
+			e.State = todo.StateTodo
+		}
+		task := todo.Task{
+			State:   e.State,
+			Message: e.Message,
+			Attr:    map[string]string{},
 		}
+		for _, m := range opts.Fields {
+			if value, ok := e.Attr[m.Local]; ok && m.Pull() {
+				task.Attr[m.Local] = value
+			}
+		}
+		task.SetLink(extID, todo.Link{ID: add.(string)})
+		opts.setBase(&task, e)
+		result = append(result, newAction(extID, todo.Task{}, task))
 	}
-	return nil
+	return result
 }
 
-func syncRemove(r todo.Repo, local *indexedTasks, missing mapset.Set) error {
+func closes(extID string, local *indexedTasks, missing mapset.Set) []ext.PlanAction {
+	var result []ext.PlanAction
 	for _, rem := range missing.ToSlice() {
 		index := local.index[rem.(string)]
 		t := local.tasks[index]
-		t.State = todo.StateDone
-		err := r.Update(t)
+		closed := copyTask(t)
+		closed.State = todo.StateDone
+		result = append(result, newAction(extID, t, closed))
+	}
+	return result
+}
+
+func syncAdd(r todo.Repo, adds []ext.PlanAction) error {
+	for _, add := range adds {
+		_, err := r.Import(add.After)
 		if err != nil {
 			return err
 		}
@@ -179,15 +399,9 @@ func syncRemove(r todo.Repo, local *indexedTasks, missing mapset.Set) error {
 	return nil
 }
 
-func syncUpdate(r todo.Repo, external, local *indexedTasks, updated mapset.Set) error {
-	for _, up := range updated.ToSlice() {
-		externalIndex := external.index[up.(string)]
-		localIndex := local.index[up.(string)]
-		e := external.tasks[externalIndex]
-		l := local.tasks[localIndex]
-		l.Message = e.Message
-		l.State = e.State
-		err := r.Update(l)
+func syncRemove(r todo.Repo, closes []ext.PlanAction) error {
+	for _, rem := range closes {
+		err := r.Update(rem.After)
 		if err != nil {
 			return err
 		}
@@ -195,8 +409,17 @@ func syncUpdate(r todo.Repo, external, local *indexedTasks, updated mapset.Set)
 	return nil
 }
 
-func syncRevive(r todo.Repo, revived []todo.Task) error {
-	for _, t := range revived {
+func syncUpdate(r todo.Repo, opts Options, updates []ext.PlanAction) error {
+	for _, up := range updates {
+		t := up.After
+		if up.Push && opts.Handle != nil {
+			handled, err := opts.Handle(ext.Update(up.Remote, t))
+			if err != nil {
+				return err
+			}
+			t = handled
+			delete(t.Attr, ext.Outbox)
+		}
 		err := r.Update(t)
 		if err != nil {
 			return err
@@ -204,3 +427,13 @@ func syncRevive(r todo.Repo, revived []todo.Task) error {
 	}
 	return nil
 }
+
+func syncRevive(r todo.Repo, revived []ext.PlanAction) error {
+	for _, t := range revived {
+		err := r.Update(t.After)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
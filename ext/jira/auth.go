@@ -1,22 +1,195 @@
 package jira
 
 import (
+	"bufio"
 	"encoding/base64"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/jwiklund/todo/util"
+	"github.com/pkg/errors"
 )
 
-func newAuth(user, pass string) http.RoundTripper {
-	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
-	return &authTransport{basicAuth}
+// credentials of the jira server, token is the password with basic auth
+type credentials struct {
+	user   string
+	token  string
+	bearer bool
+}
+
+// credentialsFrom the uri (user and pass), the config and the environment.
+// The token is read from the uri, the variable named by token_env, the
+// output of token_command or the netrc file, in that order.
+func credentialsFrom(server, user, pass string, extra map[string]string) (credentials, error) {
+	c := credentials{user: user, token: pass}
+	if c.user == "" {
+		c.user = extra["user"]
+	}
+	if name, ok := extra["user_env"]; ok && c.user == "" {
+		c.user = os.Getenv(name)
+	}
+	var err error
+	if name, ok := extra["token_env"]; ok && c.token == "" {
+		if c.token = os.Getenv(name); c.token == "" {
+			return c, errors.Errorf("token_env %s is not set", name)
+		}
+	}
+	if command, ok := extra["token_command"]; ok && c.token == "" {
+		if c.token, err = runCommand(command); err != nil {
+			return c, err
+		}
+	}
+	if c.token == "" {
+		if c.user, c.token, err = fromNetrc(netrcPath(extra), server, c.user); err != nil {
+			return c, err
+		}
+	}
+	if c.token == "" {
+		return c, errors.New("no credentials for jira, set token_env, token_command or add the host to ~/.netrc")
+	}
+
+	switch extra["auth"] {
+	case "":
+		c.bearer = c.user == ""
+	case "basic":
+		if c.user == "" {
+			return c, errors.New("basic auth requires a user")
+		}
+	case "bearer":
+		c.bearer = true
+	default:
+		return c, errors.New("Invalid auth " + extra["auth"] + ", use basic or bearer")
+	}
+	return c, nil
+}
+
+// header the authorization header of the credentials
+func (c credentials) header() string {
+	if c.bearer {
+		return "Bearer " + c.token
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.token))
+}
+
+// runCommand the first line of the output of command, such as pass show jira
+func runCommand(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("token_command is empty")
+	}
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "Could not run token_command "+args[0])
+	}
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	return strings.TrimSpace(line), nil
+}
+
+// netrcPath the configured netrc, $NETRC or ~/.netrc
+func netrcPath(extra map[string]string) string {
+	if path, ok := extra["netrc"]; ok {
+		return util.Expand(path)
+	}
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	return util.Expand("~/.netrc")
+}
+
+// fromNetrc the login and password of the host of server, the default entry
+// if no machine matches. A login is only used if user is empty or the same,
+// a missing file has no credentials.
+func fromNetrc(path, server, user string) (string, string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return user, "", nil
+	}
+	if err != nil {
+		return user, "", errors.Wrap(err, "Could not read "+path)
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return user, "", errors.Wrap(err, "Invalid uri")
+	}
+
+	type entry struct{ machine, login, password string }
+	var entries []entry
+	words := bufio.NewScanner(strings.NewReader(string(content)))
+	words.Split(bufio.ScanWords)
+	next := func() string {
+		if words.Scan() {
+			return words.Text()
+		}
+		return ""
+	}
+	for words.Scan() {
+		switch words.Text() {
+		case "machine":
+			entries = append(entries, entry{machine: next()})
+		case "default":
+			entries = append(entries, entry{})
+		case "login":
+			if len(entries) > 0 {
+				entries[len(entries)-1].login = next()
+			}
+		case "password":
+			if len(entries) > 0 {
+				entries[len(entries)-1].password = next()
+			}
+		}
+	}
+	for _, machine := range []string{u.Hostname(), ""} {
+		for _, e := range entries {
+			if e.machine == machine && (user == "" || e.login == "" || e.login == user) {
+				if user == "" {
+					user = e.login
+				}
+				return user, e.password, nil
+			}
+		}
+	}
+	return user, "", nil
+}
+
+// newAuth authorize the requests sent by next with the credentials resolved
+// by the first request, such as by running token_command, and kept for the
+// rest of the process
+func newAuth(resolve func() (credentials, error), next http.RoundTripper) http.RoundTripper {
+	return &authTransport{resolve: resolve, base: next}
 }
 
 type authTransport struct {
-	auth string
+	resolve func() (credentials, error)
+	once    sync.Once
+	auth    string
+	err     error
+	base    http.RoundTripper
 }
 
+// RoundTrip a copy of the request with the authorization header added, a
+// round tripper must not modify the request
 func (a *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	r.Header = map[string][]string{
-		"Authorization": []string{a.auth},
+	a.once.Do(func() {
+		c, err := a.resolve()
+		a.auth, a.err = c.header(), err
+	})
+	if a.err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, a.err
+	}
+	authorized := new(http.Request)
+	*authorized = *r
+	authorized.Header = make(http.Header, len(r.Header)+1)
+	for key, values := range r.Header {
+		authorized.Header[key] = append([]string(nil), values...)
 	}
-	return http.DefaultTransport.RoundTrip(r)
+	authorized.Header.Set("Authorization", a.auth)
+	return a.base.RoundTrip(authorized)
 }
@@ -0,0 +1,127 @@
+package jira
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialsFromURI(t *testing.T) {
+	c, err := credentialsFrom("https://host", "user", "pass", map[string]string{"netrc": "/does/not/exist"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Basic dXNlcjpwYXNz", c.header())
+}
+
+func TestCredentialsFromEnv(t *testing.T) {
+	os.Setenv("TODO_TEST_TOKEN", "secret")
+	defer os.Unsetenv("TODO_TEST_TOKEN")
+
+	c, err := credentialsFrom("https://host", "", "", map[string]string{"token_env": "TODO_TEST_TOKEN"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "Bearer secret", c.header())
+
+	_, err = credentialsFrom("https://host", "", "", map[string]string{"token_env": "TODO_TEST_UNSET"})
+	assert.NotNil(t, err)
+}
+
+func TestCredentialsFromCommand(t *testing.T) {
+	c, err := credentialsFrom("https://host", "", "", map[string]string{
+		"user":          "me",
+		"token_command": "echo secret",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, credentials{user: "me", token: "secret"}, c)
+
+	c, _ = credentialsFrom("https://host", "", "", map[string]string{
+		"user":          "me",
+		"token_command": "echo secret",
+		"auth":          "bearer",
+	})
+	assert.Equal(t, "Bearer secret", c.header())
+}
+
+func TestCredentialsFromNetrc(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "netrc")
+	defer os.RemoveAll(dir)
+	netrc := filepath.Join(dir, "netrc")
+	ioutil.WriteFile(netrc, []byte("machine other login x password y\n"+
+		"machine jira.example.com\n  login me\n  password secret\n"+
+		"default login anonymous password guest\n"), 0600)
+
+	c, err := credentialsFrom("https://jira.example.com:8443", "", "", map[string]string{"netrc": netrc})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, credentials{user: "me", token: "secret"}, c)
+
+	c, _ = credentialsFrom("https://unknown.example.com", "", "", map[string]string{"netrc": netrc})
+	assert.Equal(t, credentials{user: "anonymous", token: "guest"}, c)
+
+	_, err = credentialsFrom("https://host", "", "", map[string]string{"netrc": filepath.Join(dir, "missing")})
+	assert.NotNil(t, err)
+}
+
+func TestAuthKeepsHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, nil)
+	req.Header.Set("Content-Type", "application/json")
+	client := http.Client{Transport: newAuth(func() (credentials, error) {
+		return credentials{token: "secret", bearer: true}, nil
+	}, http.DefaultTransport)}
+	res, err := client.Do(req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	res.Body.Close()
+	assert.Equal(t, "application/json", got.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", got.Get("Authorization"))
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+}
+
+func TestAuthLazy(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	resolved := 0
+	client := http.Client{Transport: newAuth(func() (credentials, error) {
+		resolved++
+		return credentials{token: "secret", bearer: true}, nil
+	}, http.DefaultTransport)}
+	assert.Equal(t, 0, resolved, "not before the first request")
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(server.URL)
+		if !assert.Nil(t, err) {
+			return
+		}
+		res.Body.Close()
+	}
+	assert.Equal(t, 1, resolved)
+	assert.Equal(t, 2, calls)
+
+	client = http.Client{Transport: newAuth(func() (credentials, error) {
+		return credentials{}, errors.New("no credentials")
+	}, http.DefaultTransport)}
+	_, err := client.Get(server.URL)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,132 @@
+package jira
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// snapshot what was last read from jira, for when it can not be reached
+type snapshot struct {
+	// Issues by key
+	Issues map[string]jira.Issue
+	// Transitions available from each issue, by key
+	Transitions map[string][]transition
+}
+
+func (t *extJira) loadSnapshot() (snapshot, time.Time, error) {
+	s := snapshot{}
+	saved, err := t.cache.Load(&s)
+	if s.Issues == nil {
+		s.Issues = map[string]jira.Issue{}
+	}
+	if s.Transitions == nil {
+		s.Transitions = map[string][]transition{}
+	}
+	return s, saved, err
+}
+
+func (t *extJira) saveSnapshot(s snapshot) {
+	if err := t.cache.Save(s); err != nil {
+		jiraLog.Warnf("Could not cache issues of %s: %v", t.id, err)
+	}
+}
+
+// refresh the cached issues with those read by a sync, a full read replaces
+// them all
+func (t *extJira) refresh(s scope) {
+	snap, _, err := t.loadSnapshot()
+	if err != nil && err != ext.ErrNotCached {
+		jiraLog.Debugf("Replacing the cache of %s: %v", t.id, err)
+	}
+	if s.full {
+		snap.Issues = map[string]jira.Issue{}
+	}
+	for _, issue := range s.issues {
+		snap.Issues[issue.Key] = issue
+	}
+	for _, key := range s.gone {
+		delete(snap.Issues, key)
+	}
+	for key := range snap.Transitions {
+		if _, ok := snap.Issues[key]; !ok {
+			delete(snap.Transitions, key)
+		}
+	}
+	t.saveSnapshot(snap)
+}
+
+// fromCache the scope of the cached issues when jira could not be reached,
+// partial so that no task is closed. The error is returned if nothing was
+// cached.
+func (t *extJira) fromCache(offline error) (scope, error) {
+	snap, saved, err := t.loadSnapshot()
+	if err != nil {
+		jiraLog.Debugf("No cache of %s: %v", t.id, err)
+		return scope{}, offline
+	}
+	var keys []string
+	for key := range snap.Issues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var issues []jira.Issue
+	for _, key := range keys {
+		issues = append(issues, snap.Issues[key])
+	}
+	jiraLog.Warnf("%s can not be reached, using the issues cached at %s", t.id, saved.Local().Format("2006-01-02 15:04"))
+	return scope{issues: issues, partial: true, truncated: true, cached: &saved}, nil
+}
+
+// Describe the issue linked by link, from the cache if jira can not be
+// reached
+func (t *extJira) Describe(link todo.Link) (ext.Description, error) {
+	if link.ID == "" {
+		return ext.Description{}, errors.New("the task has no jira issue yet")
+	}
+	d := ext.Description{ID: link.ID}
+	issue := jira.Issue{}
+	err := t.getJSON("/rest/api/2/issue/"+link.ID, &issue)
+	var transitions []transition
+	if err == nil {
+		transitions, err = t.available(link.ID)
+	}
+	snap, saved, cerr := t.loadSnapshot()
+	switch {
+	case err == nil:
+		snap.Issues[link.ID] = issue
+		snap.Transitions[link.ID] = transitions
+		t.saveSnapshot(snap)
+	case !ext.Offline(err):
+		return d, err
+	case cerr != nil:
+		return d, err
+	default:
+		cached, ok := snap.Issues[link.ID]
+		if !ok {
+			return d, err
+		}
+		issue, transitions, d.Cached = cached, snap.Transitions[link.ID], &saved
+	}
+
+	d.Fields = map[string]string{"url": strings.TrimRight(t.url, "/") + "/browse/" + link.ID}
+	fields := issueFields(issue)
+	for _, name := range []string{"status", "assignee", "updated"} {
+		if value := fieldValue(fields[name]); value != "" {
+			d.Fields[name] = value
+		}
+	}
+	var to []string
+	for _, tr := range transitions {
+		to = append(to, tr.To.Name)
+	}
+	if len(to) > 0 {
+		d.Fields["transitions"] = strings.Join(to, ", ")
+	}
+	return d, nil
+}
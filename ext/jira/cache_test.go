@@ -0,0 +1,108 @@
+package jira
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func withCache(t *testing.T, target *extJira) func() {
+	dir, err := ioutil.TempDir("", "todo-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.cache, err = ext.NewCache(target.id, target.url, map[string]string{"cache_dir": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.RemoveAll(dir) }
+}
+
+func TestOfflineDryRun(t *testing.T) {
+	server := searchServer(2, 2, 2)
+	target := newTestJira(server.URL)
+	target.url = server.URL
+	defer withCache(t, target)()
+	r := fake.New()
+
+	plan, err := target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, plan.Cached)
+	assert.Equal(t, 2, len(plan.Adds))
+
+	server.Close()
+	plan, err = target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, plan.Cached)
+	assert.Equal(t, 2, len(plan.Adds))
+
+	_, err = target.Sync(r, false)
+	assert.NotNil(t, err, "only dry runs are served from the cache")
+}
+
+func TestOfflineNotCached(t *testing.T) {
+	server := searchServer(2, 2, 2)
+	server.Close()
+	target := newTestJira(server.URL)
+	defer withCache(t, target)()
+
+	_, err := target.Sync(fake.New(), true)
+	assert.NotNil(t, err)
+}
+
+func TestDescribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/transitions") {
+			tr := transition{ID: "21", Name: "Finish"}
+			tr.To.Name = "Done"
+			json.NewEncoder(w).Encode(struct {
+				Transitions []transition `json:"transitions"`
+			}{[]transition{tr}})
+			return
+		}
+		json.NewEncoder(w).Encode(jira.Issue{Key: "P-1", Fields: &jira.IssueFields{
+			Summary:  "issue",
+			Status:   &jira.Status{Name: "In Progress"},
+			Assignee: &jira.User{Name: "someone", DisplayName: "Someone"},
+		}})
+	}))
+	target := newTestJira(server.URL)
+	target.url = server.URL
+	defer withCache(t, target)()
+
+	d, err := target.Describe(todo.Link{ID: "P-1"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, d.Cached)
+	assert.Equal(t, "P-1", d.ID)
+	assert.Equal(t, "In Progress", d.Fields["status"])
+	assert.Equal(t, "Done", d.Fields["transitions"])
+	assert.Equal(t, server.URL+"/browse/P-1", d.Fields["url"])
+	assert.NotEmpty(t, d.Fields["assignee"])
+
+	server.Close()
+	cached, err := target.Describe(todo.Link{ID: "P-1"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.NotNil(t, cached.Cached)
+	assert.Equal(t, d.Fields, cached.Fields)
+
+	_, err = target.Describe(todo.Link{ID: "P-2"})
+	assert.NotNil(t, err, "not cached")
+}
@@ -0,0 +1,165 @@
+package jira
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+func (t *extJira) Capabilities() ext.Capabilities {
+	return ext.Capabilities{
+		States:   t.statuses.states(),
+		Fields:   t.fields,
+		Mappable: true,
+		Create:   true,
+		Delete:   true,
+		TwoWay:   true,
+	}
+}
+
+func (t *extJira) Check(online bool) []ext.Diagnostic {
+	var res []ext.Diagnostic
+	if online {
+		// without a server only the config is checked
+		res, online = t.checkServer()
+	}
+	for _, state := range []todo.State{todo.StateTodo, todo.StateDone} {
+		if len(t.statuses.statuses(state)) == 0 {
+			res = append(res, ext.Diagnostic{
+				Severity: ext.SeverityWarning,
+				Message:  "no status maps to " + state.String() + ", tasks can not be moved to " + state.String() + " in jira",
+				Fix:      "add a status of " + state.String() + " to the status table",
+			})
+		}
+	}
+	if online {
+		res = append(res, t.checkStatuses()...)
+	}
+	return res
+}
+
+// checkStatuses the mapped statuses exist
+func (t *extJira) checkStatuses() []ext.Diagnostic {
+	var statuses []struct {
+		Name string `json:"name"`
+	}
+	if err := t.getJSON("/rest/api/2/status", &statuses); err != nil {
+		return []ext.Diagnostic{{
+			Severity: ext.SeverityWarning,
+			Message:  "could not list statuses to check the status mapping: " + err.Error(),
+		}}
+	}
+	exists := map[string]bool{}
+	var names []string
+	for _, s := range statuses {
+		exists[s.Name] = true
+		names = append(names, s.Name)
+	}
+	var mapped []string
+	for status := range t.statuses {
+		mapped = append(mapped, status)
+	}
+	sort.Strings(mapped)
+	var res []ext.Diagnostic
+	for _, status := range mapped {
+		if exists[status] {
+			res = append(res, ext.Diagnostic{Severity: ext.SeverityOK,
+				Message: "status " + status + " found, mapped to " + t.statuses[status].String()})
+			continue
+		}
+		res = append(res, ext.Diagnostic{
+			Severity: ext.SeverityError,
+			Message:  "status " + status + " does not exist",
+			Fix:      "map one of " + strings.Join(names, ", "),
+		})
+	}
+	return res
+}
+
+// checkServer connectivity, the project and the mapped fields, false if the
+// server could not be reached
+func (t *extJira) checkServer() ([]ext.Diagnostic, bool) {
+	var res []ext.Diagnostic
+	myself := struct {
+		Name string `json:"name"`
+	}{}
+	if err := t.getJSON("/rest/api/2/myself", &myself); err != nil {
+		return []ext.Diagnostic{{
+			Severity: ext.SeverityError,
+			Message:  "could not connect to " + t.url + ": " + err.Error(),
+			Fix:      "check the uri and the credentials",
+		}}, false
+	}
+	res = append(res, ext.Diagnostic{
+		Severity: ext.SeverityOK,
+		Message:  "connected to " + t.url + " as " + myself.Name,
+	})
+
+	if err := t.getJSON("/rest/api/2/project/"+t.project, nil); err != nil {
+		res = append(res, ext.Diagnostic{
+			Severity: ext.SeverityError,
+			Message:  "project " + t.project + " not found: " + err.Error(),
+			Fix:      "set project to the key of a project " + myself.Name + " can browse",
+		})
+	} else {
+		res = append(res, ext.Diagnostic{Severity: ext.SeverityOK, Message: "project " + t.project + " found"})
+	}
+
+	if len(t.fields) == 0 {
+		return res, true
+	}
+	var fields []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := t.getJSON("/rest/api/2/field", &fields); err != nil {
+		res = append(res, ext.Diagnostic{
+			Severity: ext.SeverityWarning,
+			Message:  "could not list fields to check the mappings: " + err.Error(),
+		})
+		return res, true
+	}
+	for _, m := range t.fields {
+		found, named := false, ""
+		for _, f := range fields {
+			if f.ID == m.Remote {
+				found = true
+			} else if strings.EqualFold(f.Name, m.Remote) {
+				named = f.ID
+			}
+		}
+		switch {
+		case found:
+			res = append(res, ext.Diagnostic{Severity: ext.SeverityOK, Message: "field " + m.Remote + " found"})
+		case named != "":
+			res = append(res, ext.Diagnostic{
+				Severity: ext.SeverityError,
+				Message:  "field " + m.Remote + " of " + m.Local + " is a name, not an id",
+				Fix:      "set remote = \"" + named + "\"",
+			})
+		default:
+			res = append(res, ext.Diagnostic{
+				Severity: ext.SeverityError,
+				Message:  "field " + m.Remote + " of " + m.Local + " does not exist",
+				Fix:      "set remote to a field id, such as summary or customfield_10010",
+			})
+		}
+	}
+	return res, true
+}
+
+// getJSON get path and decode the response into v, unless nil
+func (t *extJira) getJSON(path string, v interface{}) error {
+	req, err := t.client.NewRequest("GET", path, nil)
+	if err != nil {
+		return errors.Wrap(err, "Could not create request")
+	}
+	res, err := t.client.Do(req, v)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package jira
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// Comment add a comment to the linked issue
+func (t *extJira) Comment(link todo.Link, body string) error {
+	if link.ID == "" {
+		return errors.New("the task has no jira issue yet, sync it first")
+	}
+	comment := struct {
+		Body string `json:"body"`
+	}{body}
+	req, err := t.client.NewRequest("POST", "/rest/api/2/issue/"+link.ID+"/comment", &comment)
+	if err != nil {
+		return errors.Wrap(err, "Could not create comment request")
+	}
+	jiraLog.Debugf("POST /rest/api/2/issue/%s/comment", link.ID)
+	res, err := t.client.Do(req, nil)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		if res != nil {
+			body, _ := ioutil.ReadAll(res.Body)
+			jiraLog.Debug("Jira response ", string(body))
+		}
+		return errors.Wrap(err, "Could not add comment")
+	}
+	return nil
+}
+
+// comments the comments of an issue, one per line (or more if the body has
+// several) as "<created> <author>: <body>"
+func comments(value interface{}) string {
+	field, _ := value.(map[string]interface{})
+	list, _ := field["comments"].([]interface{})
+	var res []string
+	for _, item := range list {
+		comment, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		created, _ := comment["created"].(string)
+		if len(created) >= 16 {
+			// 2017-01-02T10:00:00.000+0100
+			created = strings.Replace(created[:16], "T", " ", 1)
+		}
+		author := ""
+		if a, ok := comment["author"].(map[string]interface{}); ok {
+			author, _ = a["displayName"].(string)
+			if author == "" {
+				author = fieldValue(a)
+			}
+		}
+		body, _ := comment["body"].(string)
+		body = strings.TrimSpace(strings.Replace(body, "\r\n", "\n", -1))
+		res = append(res, created+" "+author+": "+body)
+	}
+	return strings.Join(res, "\n")
+}
@@ -0,0 +1,40 @@
+package jira
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComments(t *testing.T) {
+	var field interface{}
+	json.Unmarshal([]byte(`{"comments": [
+		{"author": {"name": "me", "displayName": "Me"}, "created": "2017-01-02T10:00:00.000+0100", "body": "first\r\nline"},
+		{"author": {"name": "you"}, "created": "2017-01-03T11:30:00.000+0100", "body": "second"}
+	]}`), &field)
+	assert.Equal(t, "2017-01-02 10:00 Me: first\nline\n2017-01-03 11:30 you: second", comments(field))
+	assert.Equal(t, "", comments(nil))
+}
+
+func TestComment(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		path, body = r.URL.Path, string(bs)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	target := newTestJira(server.URL)
+	if !assert.Nil(t, target.Comment(todo.Link{ID: "P-1"}, "looks good")) {
+		return
+	}
+	assert.Equal(t, "/rest/api/2/issue/P-1/comment", path)
+	assert.JSONEq(t, `{"body": "looks good"}`, body)
+	assert.NotNil(t, target.Comment(todo.Link{}, "no issue"))
+}
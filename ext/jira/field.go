@@ -0,0 +1,201 @@
+package jira
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// jira fields holding a list of values, and those holding named objects
+var (
+	listFields = map[string]bool{"labels": true, "components": true, "fixVersions": true, "versions": true}
+	nameFields = map[string]bool{"priority": true, "components": true, "fixVersions": true, "versions": true,
+		"assignee": true, "reporter": true, "issuetype": true}
+)
+
+// defaultFields synced unless the attribute is mapped in the config or
+// default_fields is false
+var defaultFields = []ext.FieldMap{
+	{Local: "assignee", Remote: "assignee", Direction: ext.DirectionPull},
+	{Local: "comments", Remote: "comment", Direction: ext.DirectionPull, ReadOnly: true},
+	{Local: "due", Remote: "duedate", Direction: ext.DirectionBoth},
+	{Local: "note", Remote: "description", Direction: ext.DirectionBoth},
+	{Local: "parent", Remote: "parent", Direction: ext.DirectionPull},
+	{Local: "prio", Remote: "priority", Direction: ext.DirectionBoth, Ranges: true, Values: map[string]string{
+		"100": "Highest", "500": "High", "1000": "Medium", "1500": "Low", "2000": "Lowest",
+	}},
+	{Local: "tags", Remote: "labels", Direction: ext.DirectionBoth},
+	{Local: "type", Remote: "issuetype", Direction: ext.DirectionPull},
+}
+
+// withDefaults the configured field mappings and the default mappings of the
+// attributes that are not configured, sorted by local name. Epic is mapped to
+// the epic link field if there is one.
+func withDefaults(fields []ext.FieldMap, extra map[string]string, epicField string) ([]ext.FieldMap, error) {
+	if value, ok := extra["default_fields"]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid default_fields")
+		}
+		if !enabled {
+			return fields, nil
+		}
+	}
+	configured := map[string]bool{}
+	for _, m := range fields {
+		configured[m.Local] = true
+	}
+	res := append([]ext.FieldMap{}, fields...)
+	defaults := append([]ext.FieldMap{}, defaultFields...)
+	if epicField != "" {
+		defaults = append(defaults, ext.FieldMap{Local: "epic", Remote: epicField, Direction: ext.DirectionBoth})
+	}
+	for _, m := range defaults {
+		if !configured[m.Local] {
+			res = append(res, m)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Local < res[j].Local })
+	return res, nil
+}
+
+// issueFields the fields of an issue by jira field name, custom fields included
+func issueFields(issue jira.Issue) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if issue.Fields == nil {
+		return fields
+	}
+	bs, err := json.Marshal(issue.Fields)
+	if err != nil {
+		jiraLog.Debugf("Could not read fields of %s: %v", issue.Key, err)
+		return fields
+	}
+	if err := json.Unmarshal(bs, &fields); err != nil {
+		jiraLog.Debugf("Could not read fields of %s: %v", issue.Key, err)
+	}
+	return fields
+}
+
+// fieldValue a jira field value as a string, lists are comma separated and
+// objects are represented by their name
+func fieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s := fieldValue(item); s != "" {
+				values = append(values, s)
+			}
+		}
+		return strings.Join(values, ",")
+	case map[string]interface{}:
+		for _, key := range []string{"name", "value", "displayName", "key"} {
+			if s, ok := v[key].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// pulled the local attributes of the mapped fields of issue
+func (t *extJira) pulled(issue jira.Issue) map[string]string {
+	attr := map[string]string{}
+	fields := issueFields(issue)
+	for _, m := range t.fields {
+		if !m.Pull() {
+			continue
+		}
+		value := fieldValue(fields[m.Remote])
+		switch m.Remote {
+		case "labels":
+			value = t.withoutLabel(value)
+		case "comment":
+			value = comments(fields[m.Remote])
+		}
+		if local, ok := m.ToLocal(value); ok && local != "" {
+			attr[m.Local] = local
+		} else if !ok {
+			jiraLog.Debugf("No local %s for %s %s of %s", m.Local, m.Remote, value, issue.Key)
+		}
+	}
+	return attr
+}
+
+// withoutLabel the labels without the label all synced issues have
+func (t *extJira) withoutLabel(labels string) string {
+	var res []string
+	for _, l := range strings.Split(labels, ",") {
+		if l != "" && l != t.label {
+			res = append(res, l)
+		}
+	}
+	return strings.Join(res, ",")
+}
+
+// created the jira fields of the mapped attributes of a new task, empty
+// fields are left out
+func (t *extJira) created(task todo.Task) map[string]interface{} {
+	fields := t.pushed(ext.Create(task))
+	for field, value := range fields {
+		if value == nil {
+			delete(fields, field)
+		}
+	}
+	return fields
+}
+
+// pushed the jira fields of the mapped attributes changed by d
+func (t *extJira) pushed(d ext.Delta) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for _, m := range t.fields {
+		if !m.Push() || !d.Changed(m.Local) {
+			continue
+		}
+		value, ok := m.ToRemote(d.Task.Attr[m.Local])
+		if !ok {
+			jiraLog.Warnf("No %s for %s %s of %s, not written to jira", m.Remote, m.Local, d.Task.Attr[m.Local], d.Task.ID)
+			continue
+		}
+		fields[m.Remote] = t.remoteValue(m.Remote, value)
+	}
+	return fields
+}
+
+// remoteValue the jira representation of value for field
+func (t *extJira) remoteValue(field, value string) interface{} {
+	name := func(v string) interface{} {
+		if nameFields[field] {
+			return map[string]string{"name": v}
+		}
+		return v
+	}
+	if listFields[field] {
+		values := []interface{}{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, name(v))
+			}
+		}
+		if field == "labels" && t.label != "" {
+			values = append(values, t.label)
+		}
+		return values
+	}
+	if value == "" {
+		return nil
+	}
+	return name(value)
+}
@@ -0,0 +1,123 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldValue(t *testing.T) {
+	assert.Equal(t, "a,b", fieldValue([]interface{}{"a", "b"}))
+	assert.Equal(t, "High", fieldValue(map[string]interface{}{"name": "High", "id": "2"}))
+	assert.Equal(t, "3", fieldValue(float64(3)))
+	assert.Equal(t, "", fieldValue(nil))
+}
+
+func TestFields(t *testing.T) {
+	target := &extJira{id: "jira", label: "todo", fields: []ext.FieldMap{
+		{Local: "prio", Remote: "priority", Direction: ext.DirectionBoth, Values: map[string]string{"1": "High"}},
+		{Local: "tags", Remote: "labels", Direction: ext.DirectionBoth},
+	}}
+	issue := jira.Issue{Key: "P-1", Fields: &jira.IssueFields{
+		Labels:   []string{"todo", "home"},
+		Priority: &jira.Priority{Name: "High"},
+	}}
+	assert.Equal(t, map[string]string{"prio": "1", "tags": "home"}, target.pulled(issue))
+
+	task := todo.Task{Message: "m", Attr: map[string]string{"prio": "1", "tags": "home, work"}}
+	assert.Equal(t, map[string]interface{}{
+		"priority": map[string]string{"name": "High"},
+		"labels":   []interface{}{"home", "work", "todo"},
+	}, target.pushed(ext.Create(task)))
+
+	prev := task
+	task.Attr = map[string]string{"prio": "2", "tags": "home, work"}
+	assert.Equal(t, map[string]interface{}{}, target.pushed(ext.Update(prev, task)))
+}
+
+func TestDefaultFields(t *testing.T) {
+	fields, err := withDefaults([]ext.FieldMap{{Local: "prio", Remote: "customfield_1", Direction: ext.DirectionPull}}, map[string]string{}, "customfield_2")
+	if !assert.Nil(t, err) {
+		return
+	}
+	var locals []string
+	for _, m := range fields {
+		locals = append(locals, m.Local)
+	}
+	assert.Equal(t, []string{"assignee", "comments", "due", "epic", "note", "parent", "prio", "tags", "type"}, locals)
+	assert.Equal(t, "customfield_2", fields[3].Remote)
+	assert.Equal(t, "customfield_1", fields[6].Remote)
+
+	fields, _ = withDefaults(nil, map[string]string{"default_fields": "false"}, "")
+	assert.Equal(t, 0, len(fields))
+}
+
+func TestDefaultFieldsSync(t *testing.T) {
+	target := &extJira{id: "jira", fields: defaultFields}
+	issue := jira.Issue{}
+	json.Unmarshal([]byte(`{"key": "P-1", "fields": {
+		"description": "line\nline",
+		"assignee": {"name": "me", "displayName": "Me"},
+		"priority": {"name": "High"},
+		"duedate": "2017-01-02"}}`), &issue)
+	assert.Equal(t, map[string]string{"note": "line\nline", "assignee": "me", "prio": "500", "due": "2017-01-02"},
+		target.pulled(issue))
+
+	task := todo.Task{Message: "m", Attr: map[string]string{"prio": "100", "due": "2017-01-03", "assignee": "me"}}
+	assert.Equal(t, map[string]interface{}{
+		"priority": map[string]string{"name": "Highest"},
+		"duedate":  "2017-01-03",
+		"labels":   []interface{}{},
+	}, target.created(task))
+}
+
+func TestPrioRanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "P-1", "fields": {
+			"summary": "m", "status": {"name": "To Do"}, "priority": {"name": "Highest"}}}]}`))
+	}))
+	defer server.Close()
+	target := newTestJira(server.URL)
+	target.fields = defaultFields
+
+	r := fake.New()
+	task := r.MustAdd("m", map[string]string{"prio": "10"})
+	task.SetLink("jira", todo.Link{ID: "P-1"})
+	r.MustUpdate(task)
+	plan, err := target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for _, update := range plan.Updates {
+		assert.Equal(t, "10", update.After.Attr["prio"], "a prio in the range of the priority is kept")
+	}
+
+	d := ext.Update(todo.Task{Message: "m", Attr: map[string]string{"prio": "10"}},
+		todo.Task{Message: "m", Attr: map[string]string{"prio": "700"}})
+	assert.Equal(t, map[string]interface{}{"priority": map[string]string{"name": "Medium"}}, target.pushed(d))
+}
+
+func TestNewIssue(t *testing.T) {
+	target := &extJira{project: "P", issueType: "Story", subtaskType: "Sub-task", fields: defaultFields}
+
+	issue := target.newIssue(todo.Task{Message: "m"})
+	assert.Equal(t, "Story", issue.Fields.Type.Name)
+
+	issue = target.newIssue(todo.Task{Message: "m", Attr: map[string]string{"parent": "P-1"}})
+	assert.Equal(t, "Sub-task", issue.Fields.Type.Name)
+	assert.Equal(t, map[string]string{"key": "P-1"}, issue.Fields.Unknowns["parent"])
+
+	issue = target.newIssue(todo.Task{Message: "m", Attr: map[string]string{"parent": "3"}})
+	assert.Equal(t, "Story", issue.Fields.Type.Name)
+	assert.Nil(t, issue.Fields.Unknowns["parent"])
+
+	issue = target.newIssue(todo.Task{Message: "m", Attr: map[string]string{"type": "Bug"}})
+	assert.Equal(t, "Bug", issue.Fields.Type.Name)
+}
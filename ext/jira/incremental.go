@@ -0,0 +1,140 @@
+package jira
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// defaultFullSync how often all issues are read to reconcile, between
+// full syncs only the issues updated since last sync are read
+const defaultFullSync = 24 * time.Hour
+
+// keysPerSearch linked issues looked up per search, to keep the jql short
+const keysPerSearch = 50
+
+// meta keys of the time of the last sync and the last full sync
+const (
+	metaLastSync = "last_sync"
+	metaLastFull = "last_full"
+)
+
+var now = time.Now
+
+// scope the issues read by a sync
+type scope struct {
+	issues []jira.Issue
+	// partial true if only some of the issues were read
+	partial bool
+	// gone linked issues updated since last sync that left the query
+	gone []string
+	// full true if all issues were read
+	full bool
+	// truncated true if the search looked truncated
+	truncated bool
+	started   time.Time
+	// cached when the issues were cached, if read from the cache
+	cached *time.Time
+}
+
+func (t *extJira) metaKey(name string) string {
+	return t.id + "." + name
+}
+
+// syncTime the time stored in meta key name, zero if none
+func (t *extJira) syncTime(r todo.Repo, name string) time.Time {
+	value, err := r.Meta(t.metaKey(name))
+	if err != nil || value == "" {
+		return time.Time{}
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		jiraLog.Debugf("Invalid %s %s, doing a full sync", name, value)
+		return time.Time{}
+	}
+	return parsed
+}
+
+// fetch the issues updated since last sync, or all issues if never synced or
+// if it is time for a full sync
+func (t *extJira) fetch(r todo.Repo, local []todo.Task) (scope, error) {
+	started := now()
+	last := t.syncTime(r, metaLastSync)
+	full := t.syncTime(r, metaLastFull)
+	if t.fullSync <= 0 || last.IsZero() || full.IsZero() || started.Sub(full) >= t.fullSync {
+		return t.fetchAll(started)
+	}
+
+	// relative to avoid the time zone of the jira user, with a margin for
+	// clock skew
+	since := " AND updated >= -" + strconv.Itoa(int(started.Sub(last).Minutes())+2) + "m"
+	issues, truncated, err := t.search("(" + t.query() + ")" + since)
+	if err != nil {
+		return scope{}, err
+	}
+	changed := map[string]bool{}
+	for _, issue := range issues {
+		changed[issue.Key] = true
+	}
+	var gone []string
+	keys := linkedKeys(t.id, local)
+	for len(keys) > 0 {
+		n := keysPerSearch
+		if n > len(keys) {
+			n = len(keys)
+		}
+		linked, _, err := t.search("key in (" + strings.Join(keys[:n], ",") + ")" + since)
+		if err != nil {
+			// such as a deleted issue, which is not a valid key
+			jiraLog.Debugf("Could not look up linked issues, doing a full sync: %v", err)
+			return t.fetchAll(started)
+		}
+		for _, issue := range linked {
+			if !changed[issue.Key] {
+				gone = append(gone, issue.Key)
+			}
+		}
+		keys = keys[n:]
+	}
+	jiraLog.Debugf("Incremental sync of %s, %d changed, %d gone", t.id, len(issues), len(gone))
+	return scope{issues, true, gone, false, truncated, started, nil}, nil
+}
+
+func (t *extJira) fetchAll(started time.Time) (scope, error) {
+	issues, truncated, err := t.search(t.query())
+	if truncated {
+		jiraLog.Warnf("Search of %s looks truncated, tasks missing from it are not closed", t.id)
+	}
+	return scope{issues, truncated, nil, !truncated, truncated, started, nil}, err
+}
+
+// synced remember when the sync started, unless the search looked truncated
+// in which case the next sync reads the same issues again
+func (t *extJira) synced(r todo.Repo, s scope) error {
+	if s.truncated {
+		return nil
+	}
+	started := s.started.UTC().Format(time.RFC3339)
+	if err := r.SetMeta(t.metaKey(metaLastSync), started); err != nil {
+		return errors.Wrap(err, "Could not save time of sync")
+	}
+	if s.full {
+		return errors.Wrap(r.SetMeta(t.metaKey(metaLastFull), started), "Could not save time of sync")
+	}
+	return nil
+}
+
+// linkedKeys the issues local tasks are linked to
+func linkedKeys(extID string, tasks []todo.Task) []string {
+	var keys []string
+	for _, task := range tasks {
+		if l, ok := task.Link(extID); ok && l.ID != "" && !l.Detached() {
+			keys = append(keys, l.ID)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,72 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrementalSync(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jql := r.URL.Query().Get("jql")
+		queries = append(queries, jql)
+		issue := func(key, status string) jira.Issue {
+			return jira.Issue{Key: key, Fields: &jira.IssueFields{Summary: key, Status: &jira.Status{Name: status}}}
+		}
+		res := searchPage{Issues: []jira.Issue{issue("P-1", "To Do")}}
+		if strings.HasPrefix(jql, "key in") {
+			res.Issues = append(res.Issues, issue("P-2", "Done"))
+		}
+		res.Total = len(res.Issues)
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+	defer func() { now = time.Now }()
+	started := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return started }
+
+	r := fake.New()
+	for _, key := range []string{"P-1", "P-2", "P-3"} {
+		task := r.MustAdd(key, nil)
+		task.SetLink("jira", todo.Link{ID: key})
+		r.MustUpdate(task)
+	}
+	r.SetMeta("jira.last_sync", "2017-01-01T11:50:00Z")
+	r.SetMeta("jira.last_full", "2017-01-01T08:00:00Z")
+	target := newTestJira(server.URL)
+	target.fullSync = defaultFullSync
+
+	plan, err := target.Sync(r, false)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{
+		"(status != Done AND project = P) AND updated >= -12m",
+		"key in (P-1,P-2,P-3) AND updated >= -12m",
+	}, queries)
+	if assert.Equal(t, 1, len(plan.Closes)) {
+		assert.Equal(t, "P-2", plan.Closes[0].ExternalID)
+	}
+	assert.Equal(t, todo.StateTodo, r.MustGet("2").State)
+	last, _ := r.Meta("jira.last_sync")
+	assert.Equal(t, "2017-01-01T12:00:00Z", last)
+	full, _ := r.Meta("jira.last_full")
+	assert.Equal(t, "2017-01-01T08:00:00Z", full)
+
+	// full sync when it is time for one
+	queries = nil
+	now = func() time.Time { return started.Add(defaultFullSync) }
+	if _, err := target.Sync(r, true); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"status != Done AND project = P"}, queries)
+}
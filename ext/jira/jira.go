@@ -2,6 +2,7 @@ package jira
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"regexp"
@@ -11,6 +12,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/andygrunwald/go-jira"
 	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/ext/internal"
 	"github.com/jwiklund/todo/todo"
 	"github.com/pkg/errors"
 )
@@ -23,13 +25,23 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
-		jiraLog.Debugf("%v", cfg)
+		// not the uri or config, they may hold credentials
+		jiraLog.Debugf("External %s at %s", cfg.ID, url)
 		return New(cfg.ID, url, user, pass, cfg.Extra)
 	})
 }
 
+// valueOr value, otherwise if empty
+func valueOr(value, otherwise string) string {
+	if value == "" {
+		return otherwise
+	}
+	return value
+}
+
+// splitURI into the server, user and pass, which are optional
 func splitURI(uri string) (string, string, string, error) {
-	r := regexp.MustCompile("^(https?://)([^:/@]+):([^@/]+)@(.*)$")
+	r := regexp.MustCompile("^(https?://)(?:([^:/@]+)(?::([^@/]+))?@)?([^@]+)$")
 	match := r.FindStringSubmatch(uri)
 	if match == nil {
 		return "", "", "", errors.New("invalid uri")
@@ -45,6 +57,33 @@ func New(id, url, user, pass string, extra map[string]string) (ext.External, err
 		return nil, errors.New("project is required for jira")
 	}
 	label, _ := extra["label"]
+	policy, err := internal.PolicyFrom(extra["conflict"])
+	if err != nil {
+		return nil, err
+	}
+	fields, err := ext.FieldMaps(extra)
+	if err != nil {
+		return nil, err
+	}
+	if fields, err = withDefaults(fields, extra, extra["epic_field"]); err != nil {
+		return nil, err
+	}
+	mine := false
+	if value, ok := extra["mine"]; ok {
+		if mine, err = strconv.ParseBool(value); err != nil {
+			return nil, errors.Wrap(err, "Invalid mine")
+		}
+	}
+	fullSync := defaultFullSync
+	if value, ok := extra["full_sync"]; ok {
+		if fullSync, err = time.ParseDuration(value); err != nil {
+			return nil, errors.Wrap(err, "Invalid full_sync")
+		}
+	}
+	statuses, err := statusesFrom(extra)
+	if err != nil {
+		return nil, err
+	}
 	stateTransitions := map[string]string{}
 	for _, state := range todo.States {
 		if transition, ok := extra[state.String()+"_transition"]; ok {
@@ -52,136 +91,213 @@ func New(id, url, user, pass string, extra map[string]string) (ext.External, err
 		}
 	}
 
-	httpClient := http.Client{
-		Timeout:   time.Duration(10 * time.Second),
-		Transport: newAuth(user, pass),
+	httpConfig, err := ext.HTTPConfigFrom(extra)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := httpConfig.Client(func(next http.RoundTripper) http.RoundTripper {
+		// not before talking to jira, commands that do not should not need them
+		return newAuth(func() (credentials, error) {
+			return credentialsFrom(url, user, pass, extra)
+		}, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := ext.NewCache(id, url, extra)
+	if err != nil {
+		return nil, err
 	}
 
-	client, err := jira.NewClient(&httpClient, url)
+	client, err := jira.NewClient(httpClient, url)
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not create jira client")
 	}
 
 	return &extJira{
 		id:          id,
+		url:         url,
 		project:     project,
 		label:       label,
+		jql:         extra["jql"],
+		mine:        mine,
+		issueType:   valueOr(extra["issue_type"], "Story"),
+		subtaskType: valueOr(extra["subtask_type"], "Sub-task"),
+		fullSync:    fullSync,
+		statuses:    statuses,
 		transitions: stateTransitions,
+		policy:      policy,
+		fields:      fields,
+		cache:       cache,
 		client:      client,
 	}, nil
 }
 
 type extJira struct {
 	id          string
+	url         string
 	project     string
 	label       string
+	jql         string
+	mine        bool
+	issueType   string
+	subtaskType string
+	fullSync    time.Duration
+	statuses    statusMap
 	transitions map[string]string
+	policy      internal.Policy
+	fields      []ext.FieldMap
+	cache       ext.Cache
 	client      *jira.Client
 }
 
-func (t *extJira) Handle(task todo.Task) (todo.Task, error) {
-	if a := task.Attr["external"]; a != t.id {
+func (t *extJira) Handle(d ext.Delta) (todo.Task, error) {
+	task := d.Task
+	if d.Op == ext.OpDelete {
+		// unlinked, close the issue
+		prev, ok := d.Prev.Link(t.id)
+		if !ok || prev.ID == "" || d.Prev.State == todo.StateDone {
+			return task, nil
+		}
+		if !d.Known() {
+			// retried from the outbox, it may be closed already
+			issue, err := t.get(prev.ID)
+			if err != nil {
+				return task, err
+			}
+			if issue.State == todo.StateDone {
+				return task, nil
+			}
+		}
+		return task, t.updateJiraStatus(prev.ID, todo.StateDone)
+	}
+	link, ok := task.Link(t.id)
+	if !ok {
 		return task, nil
 	}
 	if task.Message == "" {
 		return task, errors.New("message is required for jira tasks")
 	}
-	if a := task.Attr[t.id+".id"]; a != "" {
-		issue, res, err := t.client.Issue.Get(a)
-		if err != nil {
-			if res != nil {
-				res.Body.Close()
+	if a := link.ID; a != "" {
+		if !d.Known() {
+			prev, err := t.get(a)
+			if err != nil {
+				return task, err
 			}
-			return task, errors.Wrap(err, "Could not get jira issue")
+			d.Prev = prev
 		}
-		if issue.Fields.Summary != task.Message {
-			if err := t.updateJiraFields(a, task.Message, task.Attr); err != nil {
+		fields := t.pushed(d)
+		if d.Changed("message") {
+			fields["summary"] = task.Message
+		}
+		if len(fields) > 0 {
+			if err := t.updateJiraFields(a, fields); err != nil {
 				return task, err
 			}
 		}
-		if issue.Fields.Status.Name != jiraStatus(task.State) {
+		if t.moved(d.Prev.State, task.State) {
 			if err := t.updateJiraStatus(a, task.State); err != nil {
 				return task, err
 			}
 		}
-		return task, nil
+		return t.pushWorklogs(task)
 	}
+	issue := t.newIssue(task)
+	i, res, err := t.client.Issue.Create(&issue)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		if res != nil {
+			body, _ := ioutil.ReadAll(res.Body)
+			jiraLog.Debug("jira response ", string(body))
+		}
+		return task, errors.Wrap(err, "Could not create jira issue")
+	}
+	link.ID = i.Key
+	task.SetLink(t.id, link)
+	pushed, err := t.pushWorklogs(task)
+	if err != nil {
+		// the issue is created, the work is logged by the next sync
+		jiraLog.Warnf("Could not log work on %s: %v", i.Key, err)
+	}
+	return pushed, nil
+}
+
+// issueKey such as P-1
+var issueKey = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+// newIssue the issue of a new task, a subtask of the parent attribute if
+// it is an issue key, of the type attribute if set
+func (t *extJira) newIssue(task todo.Task) jira.Issue {
 	var labels []string
 	if t.label != "" {
 		labels = []string{t.label}
 	}
-	issue := jira.Issue{
+	issueType := t.issueType
+	fields := t.created(task)
+	if parent := task.Attr["parent"]; issueKey.MatchString(parent) {
+		issueType = t.subtaskType
+		fields["parent"] = map[string]string{"key": parent}
+	} else if parent != "" {
+		jiraLog.Warnf("Parent %s of %s is not an issue key, not created as a subtask", parent, task.ID)
+	}
+	if name := task.Attr["type"]; name != "" {
+		issueType = name
+	}
+	return jira.Issue{
 		Fields: &jira.IssueFields{
 			Summary: task.Message,
 			Type: jira.IssueType{
-				Name: "Story",
+				Name: issueType,
 			},
 			Project: jira.Project{
 				Key: t.project,
 			},
-			Labels: labels,
+			Labels:   labels,
+			Unknowns: fields,
 		},
 	}
-	i, res, err := t.client.Issue.Create(&issue)
-	defer res.Body.Close()
+}
+
+// get the task as jira has it
+func (t *extJira) get(key string) (todo.Task, error) {
+	issue, res, err := t.client.Issue.Get(key)
 	if err != nil {
-		body, _ := ioutil.ReadAll(res.Body)
-		jiraLog.Debug("jira response ", string(body))
-		return task, errors.Wrap(err, "Could not create jira issue")
+		if res != nil {
+			res.Body.Close()
+		}
+		return todo.Task{}, errors.Wrap(err, "Could not get jira issue")
 	}
-	task.Attr[t.id+".id"] = i.Key
-	return task, nil
+	tasks := t.tasksFor([]jira.Issue{*issue})
+	return tasks[0], nil
 }
 
 func (t *extJira) Close() error {
 	return nil
 }
 
-func (t *extJira) updateJiraFields(extID string, message string, attr map[string]string) error {
+func (t *extJira) updateJiraFields(extID string, fields map[string]interface{}) error {
 	updated := struct {
-		Fields struct {
-			Summary string `json:"summary,omitempty"`
-		} `json:"fields"`
-	}{}
+		Fields map[string]interface{} `json:"fields"`
+	}{fields}
 	req, err := t.client.NewRequest("PUT", "/rest/api/2/issue/"+extID, updated)
 	if err != nil {
 		return errors.Wrap(err, "Could not create put request")
 	}
 	jiraLog.Debugf("PUT /rest/api/2/issue/%s %+v", extID, updated)
 	res, err := t.client.Do(req, nil)
-	defer res.Body.Close()
-	if err != nil {
-		body, _ := ioutil.ReadAll(res.Body)
-		jiraLog.Debug("Jira response ", string(body))
-		return errors.Wrap(err, "Could not update jira issue")
-	}
-	jiraLog.Debugf("%+v", res)
-	return nil
-}
-
-func (t *extJira) updateJiraStatus(extID string, state todo.State) error {
-	transition := struct {
-		Transition struct {
-			ID string `json:"id"`
-		} `json:"transition"`
-	}{}
-	transitionID, ok := t.transitions[state.String()]
-	if !ok {
-		return errors.New("No transition for state " + state.String())
-	}
-	transition.Transition.ID = transitionID
-	path := "/rest/api/2/issue/" + extID + "/transitions"
-	req, err := t.client.NewRequest("POST", path, &transition)
-	if err != nil {
-		return errors.Wrap(err, "Could not create update request")
-	}
-	jiraLog.Debug("POST /rest/api/2/issue/%s/transitions %+v", extID, transition)
-	res, err := t.client.Do(req, nil)
 	if res != nil {
 		defer res.Body.Close()
 	}
 	if err != nil {
-		return errors.Wrap(err, "Could not update state")
+		if res != nil {
+			body, _ := ioutil.ReadAll(res.Body)
+			jiraLog.Debug("Jira response ", string(body))
+		}
+		return errors.Wrap(err, "Could not update jira issue")
 	}
+	jiraLog.Debugf("%+v", res)
 	return nil
 }
@@ -0,0 +1,97 @@
+package jira
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// pageSize issues asked for per search request, jira may return fewer
+const pageSize = 100
+
+// maxPages stop paging after this many requests
+const maxPages = 500
+
+type searchPage struct {
+	StartAt    int          `json:"startAt"`
+	MaxResults int          `json:"maxResults"`
+	Total      int          `json:"total"`
+	Issues     []jira.Issue `json:"issues"`
+}
+
+// query the jql of the issues to sync, the configured jql or the open issues
+// of the project (with the label, assigned to the user if mine)
+func (t *extJira) query() string {
+	if t.jql != "" {
+		return t.jql
+	}
+	query := "project = " + t.project
+	if done := t.statuses.statuses(todo.StateDone); len(done) == 1 {
+		query = "status != " + quoteJQL(done[0]) + " AND " + query
+	} else if len(done) > 1 {
+		for i := range done {
+			done[i] = quoteJQL(done[i])
+		}
+		query = "status not in (" + strings.Join(done, ", ") + ") AND " + query
+	}
+	if t.label != "" {
+		query = query + " AND labels = " + t.label
+	}
+	if t.mine {
+		query = query + " AND assignee = currentUser()"
+	}
+	return query
+}
+
+// search all pages of the issues matching jql, true if the result looks
+// truncated (fewer issues than jira said matched)
+func (t *extJira) search(jql string) ([]jira.Issue, bool, error) {
+	var issues []jira.Issue
+	seen := map[string]bool{}
+	startAt, total := 0, 0
+	for pages := 0; ; pages++ {
+		if pages == maxPages {
+			jiraLog.Warnf("Stopped searching after %d pages", maxPages)
+			break
+		}
+		params := url.Values{}
+		params.Set("jql", jql)
+		params.Set("startAt", strconv.Itoa(startAt))
+		params.Set("maxResults", strconv.Itoa(pageSize))
+		// comments are not returned by default
+		params.Set("fields", "*navigable,comment")
+		page := searchPage{}
+		if err := t.getJSON("/rest/api/2/search?"+params.Encode(), &page); err != nil {
+			return nil, false, errors.Wrap(err, "Could not search issues")
+		}
+		jiraLog.Debugf("search startAt=%d,got=%d,total=%d", page.StartAt, len(page.Issues), page.Total)
+		total = page.Total
+		for _, issue := range page.Issues {
+			// issues shift between pages if they change while paging
+			if !seen[issue.Key] {
+				seen[issue.Key] = true
+				issues = append(issues, issue)
+			}
+		}
+		startAt = page.StartAt + len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total {
+			break
+		}
+	}
+	return issues, len(issues) < total, nil
+}
+
+var plainJQL = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// quoteJQL quote value unless it is a single word
+func quoteJQL(value string) string {
+	if plainJQL.MatchString(value) {
+		return value
+	}
+	return `"` + strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,82 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// searchServer serve total issues, at most page per request and none after
+// served issues
+func searchServer(total, page, served int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		res := searchPage{StartAt: startAt, MaxResults: page, Total: total, Issues: []jira.Issue{}}
+		for i := startAt; i < startAt+page && i < served; i++ {
+			res.Issues = append(res.Issues, jira.Issue{Key: "P-" + strconv.Itoa(i), Fields: &jira.IssueFields{
+				Summary: "issue",
+				Status:  &jira.Status{Name: "To Do"},
+			}})
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func newTestJira(url string) *extJira {
+	client, _ := jira.NewClient(nil, url)
+	return &extJira{id: "jira", project: "P", statuses: defaultStatuses, client: client}
+}
+
+func TestSearchPages(t *testing.T) {
+	server := searchServer(5, 2, 5)
+	defer server.Close()
+
+	issues, truncated, err := newTestJira(server.URL).search("project = P")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 5, len(issues))
+	assert.False(t, truncated)
+}
+
+func TestSearchTruncated(t *testing.T) {
+	server := searchServer(5, 2, 3)
+	defer server.Close()
+
+	issues, truncated, err := newTestJira(server.URL).search("project = P")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 3, len(issues))
+	assert.True(t, truncated)
+}
+
+func TestSyncTruncatedKeepsMissing(t *testing.T) {
+	server := searchServer(5, 2, 3)
+	defer server.Close()
+	r := fake.New()
+	task := r.MustAdd("missing", nil)
+	task.SetLink("jira", todo.Link{ID: "P-4"})
+	r.MustUpdate(task)
+
+	plan, err := newTestJira(server.URL).Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 3, len(plan.Adds))
+	assert.Equal(t, 0, len(plan.Closes))
+}
+
+func TestQuery(t *testing.T) {
+	target := &extJira{project: "P", label: "todo", statuses: defaultStatuses}
+	assert.Equal(t, "status != Done AND project = P AND labels = todo", target.query())
+	target.jql = "assignee = currentUser()"
+	assert.Equal(t, "assignee = currentUser()", target.query())
+}
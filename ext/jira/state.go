@@ -1,32 +1,79 @@
 package jira
 
-import "github.com/jwiklund/todo/todo"
-
-// TODO handle unknown states (do not change state unless explicitly requested)
-func jiraState(jiraStatus string) todo.State {
-	switch jiraStatus {
-	case "To Do":
-		return todo.StateTodo
-	case "In Progress":
-		return todo.StateDoing
-	case "Done":
-		return todo.StateDone
-	default:
-		return todo.StateTodo
+import (
+	"sort"
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// statusMap jira status -> local state, several statuses may map to the same
+// state. Configured as
+//
+//	[<external>.status]
+//	"In Review" = "doing"
+type statusMap map[string]todo.State
+
+var defaultStatuses = statusMap{
+	"To Do":       todo.StateTodo,
+	"In Progress": todo.StateDoing,
+	"Done":        todo.StateDone,
+}
+
+const statusPrefix = "status."
+
+// statusesFrom the configured status mapping, the default if none
+func statusesFrom(extra map[string]string) (statusMap, error) {
+	statuses := statusMap{}
+	for key, value := range extra {
+		if !strings.HasPrefix(key, statusPrefix) {
+			continue
+		}
+		if !todo.StateValid(value) {
+			return nil, errors.Errorf("Invalid state %s of status %s", value, strings.TrimPrefix(key, statusPrefix))
+		}
+		statuses[strings.TrimPrefix(key, statusPrefix)] = todo.StateFrom(value)
+	}
+	if len(statuses) == 0 {
+		return defaultStatuses, nil
+	}
+	return statuses, nil
+}
+
+// state of a jira status, false if the status is not mapped
+func (m statusMap) state(status string) (todo.State, bool) {
+	state, ok := m[status]
+	return state, ok
+}
+
+// statuses mapped to state, sorted
+func (m statusMap) statuses(state todo.State) []string {
+	var res []string
+	for status, s := range m {
+		if s == state {
+			res = append(res, status)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// represented state as jira represents it, states without a status are todo
+func (m statusMap) represented(state todo.State) todo.State {
+	if len(m.statuses(state)) > 0 {
+		return state
 	}
+	return todo.StateTodo
 }
 
-func jiraStatus(state todo.State) string {
-	switch state {
-	case todo.StateTodo:
-		return "To Do"
-	case todo.StateDoing:
-		return "In Progress"
-	case todo.StateWaiting:
-		return "To Do"
-	case todo.StateDone:
-		return "Done"
-	default:
-		return "To Do"
+// states the local states jira represents
+func (m statusMap) states() []todo.State {
+	var res []todo.State
+	for _, state := range todo.States {
+		if len(m.statuses(state)) > 0 {
+			res = append(res, state)
+		}
 	}
+	return res
 }
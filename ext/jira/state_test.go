@@ -0,0 +1,46 @@
+package jira
+
+import (
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/todo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusesFrom(t *testing.T) {
+	statuses, err := statusesFrom(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultStatuses, statuses)
+
+	statuses, err = statusesFrom(map[string]string{
+		"status.Open":        "todo",
+		"status.In Review":   "doing",
+		"status.Development": "doing",
+		"status.Closed":      "done",
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"Development", "In Review"}, statuses.statuses(todo.StateDoing))
+	assert.Equal(t, todo.StateTodo, statuses.represented(todo.StateWaiting))
+	assert.Equal(t, []todo.State{todo.StateTodo, todo.StateDoing, todo.StateDone}, statuses.states())
+
+	_, err = statusesFrom(map[string]string{"status.Open": "later"})
+	assert.NotNil(t, err)
+}
+
+func TestUnknownStatus(t *testing.T) {
+	target := &extJira{id: "jira", statuses: defaultStatuses}
+	tasks := target.tasksFor([]jira.Issue{
+		{Key: "P-1", Fields: &jira.IssueFields{Summary: "a", Status: &jira.Status{Name: "In Progress"}}},
+		{Key: "P-2", Fields: &jira.IssueFields{Summary: "b", Status: &jira.Status{Name: "Blocked"}}},
+	})
+	assert.Equal(t, todo.StateDoing, tasks[0].State)
+	assert.Equal(t, todo.State(""), tasks[1].State)
+}
+
+func TestQueryDoneStatuses(t *testing.T) {
+	target := &extJira{project: "P", statuses: statusMap{"Open": todo.StateTodo, "Closed": todo.StateDone, "Won't Do": todo.StateDone}}
+	assert.Equal(t, `status not in (Closed, "Won't Do") AND project = P`, target.query())
+}
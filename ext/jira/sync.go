@@ -1,50 +1,124 @@
 package jira
 
 import (
-	"io/ioutil"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/ext/internal"
 	"github.com/jwiklund/todo/todo"
 	"github.com/pkg/errors"
 )
 
-func (t *extJira) Sync(r todo.RepoBegin, dryRun bool) error {
-	localTasks, err := r.List()
+func (t *extJira) Sync(r todo.RepoBegin, dryRun bool) (ext.Plan, error) {
+	externalTasks, localTasks, s, err := t.current(r, dryRun)
+	if err != nil {
+		return ext.Plan{}, err
+	}
+
+	plan, err := internal.SyncHelper(r, t.options(s), dryRun, externalTasks, localTasks)
+	plan.Cached = s.cached
+	if err != nil || dryRun {
+		return plan, err
+	}
+	if err := t.syncWorklogs(r); err != nil {
+		return plan, errors.Wrap(err, "Could not log work")
+	}
+	return plan, t.synced(r, s)
+}
+
+// Apply a plan made by a dry run sync, the time of the last sync is kept so
+// that the next sync reads what the plan left out
+func (t *extJira) Apply(r todo.RepoBegin, plan ext.Plan) error {
+	externalTasks, localTasks, s, err := t.current(r, false)
 	if err != nil {
 		return err
 	}
 
-	query := "status != Done AND project = " + t.project
-	if t.label != "" {
-		query = query + " AND labels = " + t.label
+	return internal.ApplyHelper(r, t.options(s), plan, externalTasks, localTasks)
+}
+
+func (t *extJira) options(s scope) internal.Options {
+	return internal.Options{
+		ID:        t.id,
+		Handle:    t.Handle,
+		Normalize: t.normalize,
+		Policy:    t.policy,
+		Fields:    t.fields,
+		Partial:   s.partial,
+		Gone:      s.gone,
 	}
-	issues, res, err := t.client.Issue.Search(query, nil)
+}
+
+// current external and local tasks, and the scope of the external tasks. A
+// dry run uses the cached issues if jira can not be reached.
+func (t *extJira) current(r todo.Repo, dryRun bool) ([]todo.Task, []todo.Task, scope, error) {
+	localTasks, err := r.List()
 	if err != nil {
-		if res != nil {
-			body, _ := ioutil.ReadAll(res.Body)
-			res.Body.Close()
-			jiraLog.Debug("Jira response ", string(body))
-		}
-		return errors.Wrap(err, "Could not list issues")
+		return nil, nil, scope{}, err
 	}
 
-	externalTasks := tasksFor(t.id, issues)
+	s, err := t.fetch(r, localTasks)
+	if err != nil && dryRun && ext.Offline(err) {
+		s, err = t.fromCache(err)
+	} else if err == nil {
+		t.refresh(s)
+	}
+	if err != nil {
+		return nil, nil, s, errors.Wrap(err, "Could not list issues")
+	}
 
-	return internal.SyncHelper(r, t.id, dryRun, externalTasks, localTasks)
+	return t.tasksFor(s.issues), localTasks, s, nil
+}
+
+// normalize states without a status, such as waiting, are todo in jira and
+// mapped attributes are as they come back from jira, such as a prio of 10 is
+// Highest and read as 100
+func (t *extJira) normalize(task todo.Task) todo.Task {
+	task.State = t.statuses.represented(task.State)
+	attr := map[string]string{}
+	for key, value := range task.Attr {
+		attr[key] = value
+	}
+	for _, m := range t.fields {
+		if value, ok := attr[m.Local]; ok {
+			attr[m.Local] = m.Normalize(value)
+		}
+	}
+	task.Attr = attr
+	return task
 }
 
-func tasksFor(extID string, issues []jira.Issue) []todo.Task {
+func (t *extJira) tasksFor(issues []jira.Issue) []todo.Task {
 	var res []todo.Task
 	for _, issue := range issues {
+		state, ok := t.statuses.state(issue.Fields.Status.Name)
+		if !ok {
+			// left as it is locally
+			jiraLog.Debugf("Status %s of %s is not mapped", issue.Fields.Status.Name, issue.Key)
+		}
+		attr := t.pulled(issue)
+		if updated, ok := updated(issue); ok {
+			// for the newest conflict policy
+			attr["modified"] = updated.UTC().Format(time.RFC3339)
+		}
 		res = append(res, todo.Task{
 			Message: issue.Fields.Summary,
-			State:   jiraState(issue.Fields.Status.Name),
-			Attr: map[string]string{
-				"external":    extID,
-				extID + ".id": issue.Key,
-			},
+			State:   state,
+			Attr:    attr,
+			Links:   map[string]todo.Link{t.id: {ID: issue.Key}},
 		})
 	}
 	return res
 }
+
+// updated when the issue was last updated, false if not known
+func updated(issue jira.Issue) (time.Time, bool) {
+	value, _ := issueFields(issue)["updated"].(string)
+	for _, layout := range []string{"2006-01-02T15:04:05.000-0700", time.RFC3339Nano} {
+		if at, err := time.Parse(layout, value); err == nil {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,46 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/jwiklund/todo/ext/internal"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewestConflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"startAt": 0, "maxResults": 50, "total": 1, "issues": [{"key": "P-1", "fields": {
+			"summary": "remote", "status": {"name": "To Do"}, "updated": "2017-01-02T12:00:00.000+0100"}}]}`))
+	}))
+	defer server.Close()
+	target := newTestJira(server.URL)
+	target.policy = internal.PolicyNewest
+
+	kept := func(modified string) string {
+		r := fake.New()
+		task := r.MustAdd("local", map[string]string{"modified": modified})
+		task.SetLink("jira", todo.Link{ID: "P-1", Meta: map[string]string{"base.message": "base", "base.state": "todo"}})
+		r.MustUpdate(task)
+		plan, err := target.Sync(r, true)
+		if !assert.Nil(t, err) || !assert.Equal(t, 1, len(plan.Updates)) || !assert.Equal(t, 1, len(plan.Updates[0].Conflicts)) {
+			return ""
+		}
+		return plan.Updates[0].Conflicts[0].Kept
+	}
+	assert.Equal(t, "remote", kept("2017-01-02T10:59:00Z"))
+	assert.Equal(t, "local", kept("2017-01-02T11:01:00Z"))
+}
+
+func TestTasksForModified(t *testing.T) {
+	target := &extJira{id: "jira", statuses: defaultStatuses}
+	issue := jira.Issue{}
+	json.Unmarshal([]byte(`{"key": "P-1", "fields": {"summary": "a", "status": {"name": "To Do"},
+		"updated": "2017-01-02T12:00:00.000+0100"}}`), &issue)
+	assert.Equal(t, "2017-01-02T11:00:00Z", target.tasksFor([]jira.Issue{issue})[0].Attr["modified"])
+}
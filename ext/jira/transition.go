@@ -0,0 +1,112 @@
+package jira
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+type transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name string `json:"name"`
+	} `json:"to"`
+}
+
+func (tr transition) String() string {
+	return fmt.Sprintf("%s (%s -> %s)", tr.ID, tr.Name, tr.To.Name)
+}
+
+func describe(transitions []transition) string {
+	var res []string
+	for _, tr := range transitions {
+		res = append(res, tr.String())
+	}
+	if len(res) == 0 {
+		return "none"
+	}
+	return strings.Join(res, ", ")
+}
+
+// moved true if an issue in prev must be transitioned to represent next, an
+// issue in an unmapped status (empty prev) is moved to any mapped state
+func (t *extJira) moved(prev, next todo.State) bool {
+	if prev == "" {
+		return len(t.statuses.statuses(next)) > 0
+	}
+	return t.statuses.represented(prev) != t.statuses.represented(next)
+}
+
+// available transitions of the issue key
+func (t *extJira) available(key string) ([]transition, error) {
+	res := struct {
+		Transitions []transition `json:"transitions"`
+	}{}
+	if err := t.getJSON("/rest/api/2/issue/"+key+"/transitions", &res); err != nil {
+		return nil, errors.Wrap(err, "Could not get transitions of "+key)
+	}
+	return res.Transitions, nil
+}
+
+// transitionTo the transition moving issue key to a status of state, among the
+// available ones. The configured <state>_transition (id or name) picks one
+// when several lead to the state.
+func (t *extJira) transitionTo(key string, state todo.State) (string, error) {
+	available, err := t.available(key)
+	if err != nil {
+		return "", err
+	}
+	var candidates []transition
+	for _, tr := range available {
+		if s, ok := t.statuses.state(tr.To.Name); ok && s == state {
+			candidates = append(candidates, tr)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0].ID, nil
+	}
+	if len(candidates) == 0 {
+		return "", errors.Errorf("No transition of %s leads to %s (%s), available are %s",
+			key, state, strings.Join(t.statuses.statuses(state), ", "), describe(available))
+	}
+	configured, ok := t.transitions[state.String()]
+	if ok {
+		for _, tr := range candidates {
+			if tr.ID == configured || strings.EqualFold(tr.Name, configured) {
+				return tr.ID, nil
+			}
+		}
+	}
+	return "", errors.Errorf("Several transitions of %s lead to %s, set %s_transition to one of %s",
+		key, state, state, describe(candidates))
+}
+
+func (t *extJira) updateJiraStatus(extID string, state todo.State) error {
+	transitionID, err := t.transitionTo(extID, t.statuses.represented(state))
+	if err != nil {
+		return err
+	}
+	transition := struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+	}{}
+	transition.Transition.ID = transitionID
+	path := "/rest/api/2/issue/" + extID + "/transitions"
+	req, err := t.client.NewRequest("POST", path, &transition)
+	if err != nil {
+		return errors.Wrap(err, "Could not create update request")
+	}
+	jiraLog.Debugf("POST /rest/api/2/issue/%s/transitions %+v", extID, transition)
+	res, err := t.client.Do(req, nil)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return errors.Wrap(err, "Could not update state")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/stretchr/testify/assert"
+)
+
+// transitionServer serve transitions to the statuses, keyed by transition id
+func transitionServer(statuses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := struct {
+			Transitions []transition `json:"transitions"`
+		}{}
+		for id, status := range statuses {
+			tr := transition{ID: id, Name: "To " + status}
+			tr.To.Name = status
+			res.Transitions = append(res.Transitions, tr)
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func TestTransitionTo(t *testing.T) {
+	server := transitionServer(map[string]string{"11": "In Progress", "21": "Done", "31": "Won't Do"})
+	defer server.Close()
+	target := newTestJira(server.URL)
+
+	id, err := target.transitionTo("P-1", todo.StateDoing)
+	assert.Nil(t, err)
+	assert.Equal(t, "11", id)
+
+	_, err = target.transitionTo("P-1", todo.StateTodo)
+	assert.NotNil(t, err)
+
+	target.statuses = statusMap{"Done": todo.StateDone, "Won't Do": todo.StateDone}
+	_, err = target.transitionTo("P-1", todo.StateDone)
+	assert.NotNil(t, err, "ambiguous")
+
+	target.transitions = map[string]string{"done": "To Won't Do"}
+	id, err = target.transitionTo("P-1", todo.StateDone)
+	assert.Nil(t, err)
+	assert.Equal(t, "31", id)
+}
+
+func TestMoved(t *testing.T) {
+	target := &extJira{statuses: defaultStatuses}
+	assert.False(t, target.moved(todo.StateTodo, todo.StateWaiting))
+	assert.True(t, target.moved(todo.StateTodo, todo.StateDone))
+	assert.True(t, target.moved("", todo.StateDone))
+	assert.False(t, target.moved("", todo.StateWaiting))
+}
@@ -15,3 +15,21 @@ func TestSplitUri(t *testing.T) {
 	assert.Equal(t, "user", user)
 	assert.Equal(t, "pass", pass)
 }
+
+func TestSplitUriWithoutPass(t *testing.T) {
+	uri, user, pass, err := splitURI("https://user@host/uri")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "https://host/uri", uri)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "", pass)
+
+	uri, user, _, err = splitURI("https://host")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://host", uri)
+	assert.Equal(t, "", user)
+
+	_, _, _, err = splitURI("host")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package jira
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// marker in the comment of pushed worklogs, to find them if pushed but not
+// remembered
+func marker(i todo.Interval) string {
+	return "todo " + i.Key()
+}
+
+// unpushed the done intervals of task not yet logged on its issue
+func (t *extJira) unpushed(task todo.Task) []todo.Interval {
+	link, _ := task.Link(t.id)
+	var res []todo.Interval
+	for _, i := range task.Worklog() {
+		if i.Done() && !link.Logged(i) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// pushWorklogs log the done intervals of task not yet logged on its issue,
+// return the task with the logged intervals remembered in the link
+func (t *extJira) pushWorklogs(task todo.Task) (todo.Task, error) {
+	link, ok := task.Link(t.id)
+	if !ok || link.ID == "" || link.Detached() {
+		return task, nil
+	}
+	pending := t.unpushed(task)
+	if len(pending) == 0 {
+		return task, nil
+	}
+	logged, err := t.worklogs(link.ID)
+	if err != nil {
+		return task, err
+	}
+	for _, i := range pending {
+		id, ok := logged[marker(i)]
+		if !ok {
+			if id, err = t.addWorklog(link.ID, i); err != nil {
+				return task, err
+			}
+		}
+		link = link.Log(i, id)
+		task.SetLink(t.id, link)
+	}
+	return task, nil
+}
+
+// worklogs the ids of the worklogs of issue key pushed by todo, by marker
+func (t *extJira) worklogs(key string) (map[string]string, error) {
+	res := struct {
+		Worklogs []struct {
+			ID      string `json:"id"`
+			Comment string `json:"comment"`
+		} `json:"worklogs"`
+	}{}
+	if err := t.getJSON("/rest/api/2/issue/"+key+"/worklog", &res); err != nil {
+		return nil, errors.Wrap(err, "Could not get worklogs of "+key)
+	}
+	logged := map[string]string{}
+	for _, w := range res.Worklogs {
+		if strings.HasPrefix(w.Comment, "todo ") {
+			logged[strings.SplitN(w.Comment, "\n", 2)[0]] = w.ID
+		}
+	}
+	return logged, nil
+}
+
+// addWorklog log interval i on issue key, in whole minutes (at least one)
+func (t *extJira) addWorklog(key string, i todo.Interval) (string, error) {
+	minutes := int(i.Duration().Minutes() + 0.5)
+	if minutes < 1 {
+		minutes = 1
+	}
+	worklog := struct {
+		Started          string `json:"started"`
+		TimeSpentSeconds int    `json:"timeSpentSeconds"`
+		Comment          string `json:"comment"`
+	}{i.Start.Format("2006-01-02T15:04:05.000-0700"), minutes * 60, marker(i)}
+	req, err := t.client.NewRequest("POST", "/rest/api/2/issue/"+key+"/worklog", &worklog)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not create worklog request")
+	}
+	jiraLog.Debugf("POST /rest/api/2/issue/%s/worklog %+v", key, worklog)
+	created := struct {
+		ID string `json:"id"`
+	}{}
+	res, err := t.client.Do(req, &created)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		if res != nil {
+			body, _ := ioutil.ReadAll(res.Body)
+			jiraLog.Debug("Jira response ", string(body))
+		}
+		return "", errors.Wrap(err, "Could not add worklog")
+	}
+	return created.ID, nil
+}
+
+// syncWorklogs log the unpushed intervals of the linked tasks, such as those
+// worked on before the task was linked or just before it was done
+func (t *extJira) syncWorklogs(r todo.Repo) error {
+	tasks, err := r.WithAttr(todo.Worklog)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if !task.Attached(t.id) || len(t.unpushed(task)) == 0 {
+			continue
+		}
+		pushed, err := t.pushWorklogs(task)
+		if !pushed.Equal(task) {
+			if err := r.Update(pushed); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
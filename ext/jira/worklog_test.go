@@ -0,0 +1,90 @@
+package jira
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushWorklogs(t *testing.T) {
+	start := time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)
+	logged := todo.Interval{Start: start, End: start.Add(time.Hour)}
+	lost := todo.Interval{Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)}
+	pending := todo.Interval{Start: start.Add(4 * time.Hour), End: start.Add(4*time.Hour + 20*time.Second)}
+
+	var posted []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			// pushed before, but not remembered
+			w.Write([]byte(`{"worklogs": [{"id": "2", "comment": "todo 2017-01-02T12:00:00Z"}]}`))
+			return
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		json.Unmarshal(bs, &body)
+		posted = append(posted, body)
+		w.Write([]byte(`{"id": "3"}`))
+	}))
+	defer server.Close()
+	target := newTestJira(server.URL)
+
+	task := todo.Task{Message: "m"}
+	task.StartWork(start)
+	task.StopWork(start.Add(time.Hour))
+	task.StartWork(lost.Start)
+	task.StopWork(lost.End)
+	task.StartWork(pending.Start)
+	task.StopWork(pending.End)
+	task.StartWork(start.Add(5 * time.Hour))
+	task.SetLink("jira", todo.Link{ID: "P-1"}.Log(logged, "1"))
+
+	pushed, err := target.pushWorklogs(task)
+	if !assert.Nil(t, err) {
+		return
+	}
+	link := pushed.Links["jira"]
+	assert.Equal(t, "2", link.Meta["worklog.2017-01-02T12:00:00Z"])
+	assert.Equal(t, "3", link.Meta["worklog.2017-01-02T14:00:00Z"])
+	if assert.Equal(t, 1, len(posted)) {
+		assert.Equal(t, float64(60), posted[0]["timeSpentSeconds"])
+		assert.Equal(t, "2017-01-02T14:00:00.000+0000", posted[0]["started"])
+	}
+	assert.Empty(t, target.unpushed(pushed))
+}
+
+func TestSyncWorklogsDone(t *testing.T) {
+	posted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"worklogs": []}`))
+			return
+		}
+		posted++
+		w.Write([]byte(`{"id": "1"}`))
+	}))
+	defer server.Close()
+	target := newTestJira(server.URL)
+
+	start := time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)
+	r := fake.New()
+	r.MustAdd("idle", nil)
+	task := r.MustAdd("worked", nil)
+	task.StartWork(start)
+	task.StopWork(start.Add(time.Hour))
+	task.State = todo.StateDone
+	task.SetLink("jira", todo.Link{ID: "P-1"})
+	r.MustUpdate(task)
+
+	if !assert.Nil(t, target.syncWorklogs(r)) {
+		return
+	}
+	assert.Equal(t, 1, posted)
+	assert.Empty(t, target.unpushed(r.MustGet(task.ID)))
+}
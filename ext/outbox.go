@@ -0,0 +1,79 @@
+package ext
+
+import (
+	"encoding/json"
+
+	"github.com/jwiklund/todo/todo"
+)
+
+// Outbox attribute of tasks with local changes not yet written to their
+// externals, holds the pending change as json
+const Outbox = "outbox"
+
+// Pending a local change that could not be written to the externals
+type Pending struct {
+	// Reason the write failed
+	Reason string
+	// Op of the change
+	Op Op
+	// Removed links of the previous task, the externals the task is still to
+	// be deleted from
+	Removed map[string]todo.Link `json:",omitempty"`
+}
+
+// Queue keep task in the outbox with the change d that failed with err
+func Queue(task todo.Task, d Delta, err error) todo.Task {
+	p := Pending{Reason: err.Error(), Op: d.Op}
+	for name, l := range d.Prev.Links {
+		if _, ok := d.Task.Links[name]; !ok && l.ID != "" {
+			if p.Removed == nil {
+				p.Removed = map[string]todo.Link{}
+			}
+			p.Removed[name] = todo.Link{ID: l.ID}
+		}
+	}
+	bs, _ := json.Marshal(p)
+	attr := map[string]string{}
+	for key, value := range task.Attr {
+		attr[key] = value
+	}
+	attr[Outbox] = string(bs)
+	task.Attr = attr
+	return task
+}
+
+// Queued the pending change of a task in the outbox. Tasks queued before the
+// change was kept only have the reason, they are updated.
+func Queued(task todo.Task) (Pending, bool) {
+	value, ok := task.Attr[Outbox]
+	if !ok {
+		return Pending{}, false
+	}
+	p := Pending{}
+	if err := json.Unmarshal([]byte(value), &p); err != nil {
+		return Pending{Reason: value, Op: OpUpdate}, true
+	}
+	return p, true
+}
+
+// Replay the pending change of a task in the outbox. What the externals have
+// is not known so everything counts as changed, the removed links are the
+// previous links so that those externals get a delete.
+func Replay(task todo.Task) Delta {
+	p, _ := Queued(task)
+	attr := map[string]string{}
+	for key, value := range task.Attr {
+		if key != Outbox {
+			attr[key] = value
+		}
+	}
+	task.Attr = attr
+	prev := todo.Task{}
+	for name, l := range p.Removed {
+		prev.SetLink(name, l)
+	}
+	for name, l := range task.Links {
+		prev.SetLink(name, l)
+	}
+	return Delta{p.Op, prev, task}
+}
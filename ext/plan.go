@@ -0,0 +1,107 @@
+package ext
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// ErrorStale returned when applying a plan made for a different state
+var ErrorStale = errors.New("Tasks changed since sync was planned, plan again")
+
+// Plan changes a sync of one external will make
+type Plan struct {
+	External string
+	// Fingerprint of external and local tasks the plan was made from
+	Fingerprint string
+	Adds        []PlanAction
+	Closes      []PlanAction
+	Updates     []PlanAction
+	Revives     []PlanAction
+	// Links of external tasks to existing local tasks, instead of adds
+	Links []PlanAction `json:",omitempty"`
+	// Cached when the external tasks were cached, if the plan was made from
+	// the cache as the external could not be reached
+	Cached *time.Time `json:",omitempty"`
+}
+
+// PlanAction a change to a single local task
+type PlanAction struct {
+	ExternalID string
+	// Before local task before sync, empty for adds
+	Before todo.Task
+	// After local task after sync
+	After   todo.Task
+	Changes []FieldChange
+	// Push local changes to the external
+	Push bool
+	// Remote the task as the external has it, for updates
+	Remote    todo.Task
+	Conflicts []Conflict `json:",omitempty"`
+}
+
+// FieldChange a changed field, message, state or attribute
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// Conflict a field changed both locally and in the external
+type Conflict struct {
+	Field  string
+	Local  string
+	Remote string
+	// Kept local, remote or ask when the plan is applied
+	Kept string
+}
+
+// Kept values of a conflict
+const (
+	KeptLocal  = "local"
+	KeptRemote = "remote"
+	KeptAsk    = "ask"
+)
+
+// Stdin the terminal answers are read from, shared so that piped answers
+// buffered by one question are not lost to the next
+var Stdin = bufio.NewReader(os.Stdin)
+
+// Empty true if the plan has no changes
+func (p Plan) Empty() bool {
+	return len(p.Adds) == 0 && len(p.Closes) == 0 && len(p.Updates) == 0 &&
+		len(p.Revives) == 0 && len(p.Links) == 0
+}
+
+// LinkTo turn a planned add into a link of the external task to the existing
+// local task, which takes the message and state of the external task
+func (a PlanAction) LinkTo(local todo.Task) PlanAction {
+	linked := local
+	linked.Message = a.After.Message
+	linked.State = a.After.State
+	linked.Attr = map[string]string{}
+	for key, value := range local.Attr {
+		linked.Attr[key] = value
+	}
+	for key, value := range a.After.Attr {
+		linked.Attr[key] = value
+	}
+	for name, l := range a.After.Links {
+		linked.SetLink(name, l)
+	}
+	link := PlanAction{
+		ExternalID: a.ExternalID,
+		Before:     local,
+		After:      linked,
+	}
+	if local.Message != linked.Message {
+		link.Changes = append(link.Changes, FieldChange{"message", local.Message, linked.Message})
+	}
+	if local.State != linked.State {
+		link.Changes = append(link.Changes, FieldChange{"state", local.State.String(), linked.State.String()})
+	}
+	return link
+}
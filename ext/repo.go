@@ -6,8 +6,9 @@ import "github.com/jwiklund/todo/todo"
 type Repo interface {
 	todo.Repo
 
-	Sync(name string, dryRun bool) error
-	SyncAll(dryRun bool) error
+	Sync(name string, dryRun bool) (Plan, error)
+	SyncAll(dryRun bool) []Result
+	Apply(plans []Plan) error
 }
 
 // New configure an External
@@ -29,14 +30,18 @@ type extRepo struct {
 	ext  external
 }
 
-func (r *extRepo) Sync(name string, dryRun bool) error {
+func (r *extRepo) Sync(name string, dryRun bool) (Plan, error) {
 	return r.ext.Sync(r.repo, name, dryRun)
 }
 
-func (r *extRepo) SyncAll(dryRun bool) error {
+func (r *extRepo) SyncAll(dryRun bool) []Result {
 	return r.ext.SyncAll(r.repo, dryRun)
 }
 
+func (r *extRepo) Apply(plans []Plan) error {
+	return r.ext.Apply(r.repo, plans)
+}
+
 func (r *extRepo) Close() error {
 	e1 := r.repo.Close()
 	e2 := r.ext.Close()
@@ -53,12 +58,16 @@ func (r *extRepo) List() ([]todo.Task, error) {
 	return r.repo.List()
 }
 
+func (r *extRepo) WithAttr(key string) ([]todo.Task, error) {
+	return r.repo.WithAttr(key)
+}
+
 func (r *extRepo) Add(message string, attr map[string]string) (todo.Task, error) {
 	task, err := r.repo.Add(message, attr)
 	if err != nil {
 		return task, err
 	}
-	upd, err := r.ext.Handle(task)
+	upd, err := r.ext.Handle(Create(task))
 	if err != nil {
 		return upd, err
 	}
@@ -68,16 +77,36 @@ func (r *extRepo) Add(message string, attr map[string]string) (todo.Task, error)
 	return upd, nil
 }
 
+func (r *extRepo) Import(task todo.Task) (todo.Task, error) {
+	return r.repo.Import(task)
+}
+
 func (r *extRepo) Get(id string) (todo.Task, error) {
 	return r.repo.Get(id)
 }
 
+func (r *extRepo) GetByUUID(uuid string) (todo.Task, error) {
+	return r.repo.GetByUUID(uuid)
+}
+
 func (r *extRepo) GetByExternal(repo, extID string) (todo.Task, error) {
 	return r.repo.GetByExternal(repo, extID)
 }
 
+func (r *extRepo) Meta(key string) (string, error) {
+	return r.repo.Meta(key)
+}
+
+func (r *extRepo) SetMeta(key, value string) error {
+	return r.repo.SetMeta(key, value)
+}
+
 func (r *extRepo) Update(task todo.Task) error {
-	mod, err := r.ext.Handle(task)
+	prev, err := r.repo.Get(task.ID)
+	if err != nil {
+		return err
+	}
+	mod, err := r.ext.Handle(Update(prev, task))
 	if err != nil {
 		return err
 	}
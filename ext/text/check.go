@@ -0,0 +1,46 @@
+package text
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+)
+
+func (t *text) Capabilities() ext.Capabilities {
+	return ext.Capabilities{
+		// a line is todo, a blank line is done
+		States: []todo.State{todo.StateTodo, todo.StateDone},
+		Create: true,
+		Delete: true,
+		TwoWay: true,
+	}
+}
+
+func (t *text) Check(online bool) []ext.Diagnostic {
+	dir := filepath.Dir(t.path)
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		return []ext.Diagnostic{{
+			Severity: ext.SeverityError,
+			Message:  "directory " + dir + " does not exist",
+			Fix:      "create it or change the uri",
+		}}
+	}
+	if _, err := os.Stat(t.path); os.IsNotExist(err) {
+		return []ext.Diagnostic{{
+			Severity: ext.SeverityWarning,
+			Message:  t.path + " does not exist, it is created when a task is added",
+		}}
+	}
+	f, err := os.OpenFile(t.path, os.O_WRONLY, 0)
+	if err != nil {
+		return []ext.Diagnostic{{
+			Severity: ext.SeverityError,
+			Message:  "can not write " + t.path + ": " + err.Error(),
+			Fix:      "check the permissions of the file",
+		}}
+	}
+	f.Close()
+	return []ext.Diagnostic{{Severity: ext.SeverityOK, Message: "can write " + t.path}}
+}
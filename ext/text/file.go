@@ -8,6 +8,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/ext/internal"
 	"github.com/jwiklund/todo/todo"
 	"github.com/jwiklund/todo/util"
 	"github.com/pkg/errors"
@@ -17,12 +18,19 @@ var textLog = logrus.WithField("comp", "ext.text")
 
 func init() {
 	ext.Register("text", func(cfg ext.ExternalConfig) (ext.External, error) {
-		return New(cfg.ID, util.Expand(cfg.URI))
+		policy, err := internal.PolicyFrom(cfg.Extra["conflict"])
+		if err != nil {
+			return nil, err
+		}
+		if policy == internal.PolicyNewest {
+			return nil, errors.New("conflict newest is not supported by text, it has no modification times")
+		}
+		return New(cfg.ID, util.Expand(cfg.URI), policy)
 	})
 }
 
 // New create a new file mirror
-func New(id, path string) (ext.External, error) {
+func New(id, path string, policy internal.Policy) (ext.External, error) {
 	stat, err := os.Stat(path)
 	var input []byte
 	if err != nil {
@@ -35,7 +43,9 @@ func New(id, path string) (ext.External, error) {
 			return nil, errors.Wrap(err, "Could not open exported text")
 		}
 	}
-	return newText(id, path, input), nil
+	t := newText(id, path, input)
+	t.policy = policy
+	return t, nil
 }
 
 func newText(id, path string, input []byte) *text {
@@ -45,7 +55,7 @@ func newText(id, path string, input []byte) *text {
 	} else {
 		source = bytes.Split(input, []byte("\n"))
 	}
-	return &text{id, path, false, source}
+	return &text{id, path, false, source, internal.PolicyRemote}
 }
 
 type text struct {
@@ -53,13 +63,21 @@ type text struct {
 	path    string
 	updated bool
 	source  [][]byte
+	policy  internal.Policy
 }
 
-func (t *text) Handle(task todo.Task) (todo.Task, error) {
-	if t.id != task.External() {
+func (t *text) Handle(d ext.Delta) (todo.Task, error) {
+	task := d.Task
+	link, ok := task.Link(t.id)
+	if d.Op == ext.OpDelete {
+		link, ok = d.Prev.Link(t.id)
+	}
+	if !ok {
 		return task, nil
 	}
-	if a := task.ExternalID(); a != "" {
+	// a line that is removed or done is blanked
+	done := task.State == todo.StateDone || d.Op == ext.OpDelete
+	if a := link.ID; a != "" {
 		ind, err := strconv.Atoi(a)
 		if err != nil {
 			textLog.Debugf("Invalid id attribute %s, ignoring %s", a, task.ID)
@@ -69,17 +87,18 @@ func (t *text) Handle(task todo.Task) (todo.Task, error) {
 			textLog.Debugf("Invalid id attribute %s (range)", ind)
 			return task, nil
 		}
-		if string(t.source[ind]) != task.Message {
+		if d.Changed("message") && string(t.source[ind]) != task.Message {
 			t.source[ind] = []byte(task.Message)
 			t.updated = true
 		}
-		if task.State == todo.StateDone {
+		if done && len(t.source[ind]) != 0 {
 			t.source[ind] = []byte{}
 			t.updated = true
 		}
-	} else {
+	} else if d.Op != ext.OpDelete {
 		t.source = append(t.source, []byte(task.Message))
-		task.SetExternalID(strconv.Itoa(len(t.source) - 1))
+		link.ID = strconv.Itoa(len(t.source) - 1)
+		task.SetLink(t.id, link)
 		t.updated = true
 	}
 	return task, nil
@@ -87,7 +106,7 @@ func (t *text) Handle(task todo.Task) (todo.Task, error) {
 
 func (t *text) Close() error {
 	if t.updated {
-		return ioutil.WriteFile(t.path, bytes.Join(t.source, []byte("\n")), 0660)
+		return util.WriteFile(t.path, bytes.Join(t.source, []byte("\n")), 0660)
 	}
 	return nil
 }
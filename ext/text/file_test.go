@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
 	"github.com/jwiklund/todo/todo/fake"
 	"github.com/stretchr/testify/assert"
 )
@@ -28,17 +30,18 @@ func TestAddSync(t *testing.T) {
 		source:  [][]byte{},
 	}
 	r := fake.New()
-	task := r.MustAdd("message", map[string]string{"external": "text"})
-	task, err := target.Handle(task)
+	task := r.MustAdd("message", nil)
+	task.SetLink("text", todo.Link{})
+	task, err := target.Handle(ext.Create(task))
 	if !assert.Nil(t, err) {
 		return
 	}
 	r.MustUpdate(task)
-	if e := target.Sync(r, false); !assert.Nil(t, e) {
+	if _, e := target.Sync(r, false); !assert.Nil(t, e) {
 		return
 	}
 	assert.Equal(t, "message", str(target.source))
-	assert.Equal(t, "0", r.MustGet("0").Attr["text.id"])
+	assert.Equal(t, "0", r.MustGet("0").Links["text"].ID)
 }
 
 func TestExistingAddSync(t *testing.T) {
@@ -51,19 +54,51 @@ func TestExistingAddSync(t *testing.T) {
 		},
 	}
 	r := fake.New()
-	task := r.MustAdd("message", map[string]string{"external": "text"})
-	task, err := target.Handle(task)
+	task := r.MustAdd("message", nil)
+	task.SetLink("text", todo.Link{})
+	task, err := target.Handle(ext.Create(task))
 	if !assert.Nil(t, err) {
 		return
 	}
 	r.MustUpdate(task)
-	if e := target.Sync(r, false); !assert.Nil(t, e) {
+	if _, e := target.Sync(r, false); !assert.Nil(t, e) {
 		return
 	}
 	assert.Equal(t, "message1\nmessage", str(target.source))
-	assert.Equal(t, "1", r.MustGet("0").ExternalID())
+	assert.Equal(t, "1", r.MustGet("0").Links["text"].ID)
 }
 
 func str(lines [][]byte) string {
 	return string(bytes.Join(lines, []byte("\n")))
 }
+
+func TestHandleUnchanged(t *testing.T) {
+	target := text{
+		id:     "text",
+		path:   "path",
+		source: [][]byte{[]byte("message")},
+	}
+	prev := todo.Task{ID: "0", Message: "message", State: todo.StateTodo, Links: map[string]todo.Link{
+		"text": {ID: "0"},
+	}}
+	task := prev
+	task.State = todo.StateDoing
+
+	if _, err := target.Handle(ext.Update(prev, task)); !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, target.updated)
+
+	task.State = todo.StateDone
+	if _, err := target.Handle(ext.Update(prev, task)); !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, target.updated)
+	assert.Equal(t, "", str(target.source))
+}
+
+func TestNewestNotSupported(t *testing.T) {
+	_, err := ext.New([]ext.ExternalConfig{{Type: "text", ID: "text", URI: "/nonexistent/todo.txt",
+		Extra: map[string]string{"conflict": "newest"}}})
+	assert.NotNil(t, err)
+}
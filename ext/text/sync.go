@@ -5,13 +5,26 @@ import (
 
 	"strings"
 
+	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/ext/internal"
 	"github.com/jwiklund/todo/todo"
 )
 
 // Sync all available lines with all available items
 // TODO find existing done tasks before creating new tasks (needs find by attribute)
-func (t *text) Sync(r todo.RepoBegin, dryRun bool) error {
+func (t *text) Sync(r todo.RepoBegin, dryRun bool) (ext.Plan, error) {
+	localTasks, err := r.List()
+	if err != nil {
+		return ext.Plan{}, err
+	}
+
+	externalTasks := tasksFor(t.id, t.source)
+
+	return internal.SyncHelper(r, t.options(), dryRun, externalTasks, localTasks)
+}
+
+// Apply a plan made by a dry run sync
+func (t *text) Apply(r todo.RepoBegin, plan ext.Plan) error {
 	localTasks, err := r.List()
 	if err != nil {
 		return err
@@ -19,7 +32,25 @@ func (t *text) Sync(r todo.RepoBegin, dryRun bool) error {
 
 	externalTasks := tasksFor(t.id, t.source)
 
-	return internal.SyncHelper(r, t.id, dryRun, externalTasks, localTasks)
+	return internal.ApplyHelper(r, t.options(), plan, externalTasks, localTasks)
+}
+
+func (t *text) options() internal.Options {
+	return internal.Options{
+		ID:        t.id,
+		Handle:    t.Handle,
+		Normalize: normalize,
+		Policy:    t.policy,
+	}
+}
+
+// normalize a line only holds the message of a task that is not done
+func normalize(task todo.Task) todo.Task {
+	task.Message = strings.TrimSpace(task.Message)
+	if task.State != todo.StateDone {
+		task.State = todo.StateTodo
+	}
+	return task
 }
 
 func tasksFor(id string, source [][]byte) []todo.Task {
@@ -32,10 +63,7 @@ func tasksFor(id string, source [][]byte) []todo.Task {
 		res = append(res, todo.Task{
 			Message: m,
 			State:   todo.StateTodo,
-			Attr: map[string]string{
-				"external": id,
-				id + ".id": strconv.Itoa(i),
-			},
+			Links:   map[string]todo.Link{id: {ID: strconv.Itoa(i)}},
 		})
 	}
 	return res
@@ -3,25 +3,33 @@ package text
 import (
 	"testing"
 
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/ext/internal"
 	"github.com/jwiklund/todo/todo"
 	"github.com/jwiklund/todo/todo/fake"
 	"github.com/stretchr/testify/assert"
 )
 
+func linked(r *fake.Fake, message string, link todo.Link) {
+	task := r.MustAdd(message, nil)
+	task.SetLink("text", link)
+	r.MustUpdate(task)
+}
+
 func TestSyncEmpty(t *testing.T) {
 	r := fake.New()
-	target := &text{"text", "/tmp", false, [][]byte{}}
+	target := &text{"text", "/tmp", false, [][]byte{}, internal.PolicyRemote}
 
-	if err := target.Sync(r, false); !assert.Nil(t, err) {
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
 		return
 	}
 }
 
 func TestSyncAddSingle(t *testing.T) {
 	r := fake.New()
-	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}}
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
 
-	if err := target.Sync(r, false); !assert.Nil(t, err) {
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
 		return
 	}
 	assert.Equal(t, []todo.Task{
@@ -29,23 +37,21 @@ func TestSyncAddSingle(t *testing.T) {
 			ID:      "0",
 			Message: "line",
 			State:   todo.StateTodo,
-			Attr: map[string]string{
-				"external": "text",
-				"text.id":  "0",
-			},
+			Attr:    map[string]string{},
+			Links: map[string]todo.Link{"text": {ID: "0", Meta: map[string]string{
+				"base.message": "line",
+				"base.state":   "todo",
+			}}},
 		},
 	}, r.MustList())
 }
 
 func TestSyncSingle(t *testing.T) {
 	r := fake.New()
-	r.Add("line", map[string]string{
-		"external": "text",
-		"text.id":  "0",
-	})
-	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}}
+	linked(r, "line", todo.Link{ID: "0"})
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
 
-	if err := target.Sync(r, false); !assert.Nil(t, err) {
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
 		return
 	}
 	assert.Equal(t, 1, len(r.MustList()))
@@ -53,13 +59,10 @@ func TestSyncSingle(t *testing.T) {
 
 func TestSyncUpdate(t *testing.T) {
 	r := fake.New()
-	r.Add("original", map[string]string{
-		"external": "text",
-		"text.id":  "0",
-	})
-	target := &text{"text", "/tmp", false, [][]byte{[]byte("update")}}
+	linked(r, "original", todo.Link{ID: "0"})
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("update")}, internal.PolicyRemote}
 
-	if err := target.Sync(r, false); !assert.Nil(t, err) {
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
 		return
 	}
 	assert.Equal(t, []todo.Task{
@@ -67,29 +70,132 @@ func TestSyncUpdate(t *testing.T) {
 			ID:      "0",
 			Message: "update",
 			State:   todo.StateTodo,
-			Attr: map[string]string{
-				"external": "text",
-				"text.id":  "0",
-			},
+			Attr:    map[string]string{},
+			Links: map[string]todo.Link{"text": {ID: "0", Meta: map[string]string{
+				"base.message": "update",
+				"base.state":   "todo",
+			}}},
 		},
 	}, r.MustList())
 }
 
 func TestSyncDoubleLine(t *testing.T) {
 	r := fake.New()
-	r.Add("original", map[string]string{
-		"external": "text",
-		"text.id":  "0",
-	})
+	linked(r, "original", todo.Link{ID: "0"})
 	target := &text{"text", "/tmp", false, [][]byte{
 		[]byte("update"),
 		[]byte("new"),
-	}}
+	}, internal.PolicyRemote}
 
-	if err := target.Sync(r, false); !assert.Nil(t, err) {
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
 		return
 	}
 
 	assert.Equal(t, "update", r.MustGet("0").Message)
 	assert.Equal(t, "new", r.MustGet("1").Message)
 }
+
+func TestSyncKeepsLocalChange(t *testing.T) {
+	r := fake.New()
+	linked(r, "local", todo.Link{ID: "0", Meta: map[string]string{
+		"base.message": "original",
+		"base.state":   "todo",
+	}})
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("original")}, internal.PolicyRemote}
+
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "local", r.MustGet("0").Message)
+	assert.Equal(t, "local", r.MustGet("0").Links["text"].Meta["base.message"])
+	assert.Equal(t, "local", str(target.source))
+}
+
+func TestSyncKeepsLocalState(t *testing.T) {
+	r := fake.New()
+	linked(r, "line", todo.Link{ID: "0"})
+	task := r.MustGet("0")
+	task.State = todo.StateDoing
+	r.MustUpdate(task)
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
+
+	if _, err := target.Sync(r, false); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, todo.StateDoing, r.MustGet("0").State)
+}
+
+func TestSyncPlan(t *testing.T) {
+	r := fake.New()
+	linked(r, "original", todo.Link{ID: "0"})
+	target := &text{"text", "/tmp", false, [][]byte{
+		[]byte("update"),
+		[]byte("new"),
+	}, internal.PolicyRemote}
+
+	plan, err := target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "original", r.MustGet("0").Message)
+	assert.Equal(t, 1, len(plan.Adds))
+	assert.Equal(t, "new", plan.Adds[0].After.Message)
+	assert.Equal(t, 1, len(plan.Updates))
+	assert.Equal(t, []ext.FieldChange{{Field: "message", From: "original", To: "update"}}, plan.Updates[0].Changes)
+
+	if err := target.Apply(r, plan); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "update", r.MustGet("0").Message)
+	assert.Equal(t, "new", r.MustGet("1").Message)
+}
+
+func TestApplyStalePlan(t *testing.T) {
+	r := fake.New()
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
+
+	plan, err := target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	target.source = [][]byte{[]byte("changed")}
+
+	assert.Equal(t, ext.ErrorStale, target.Apply(r, plan))
+	assert.Equal(t, 0, len(r.MustList()))
+}
+
+func TestApplyLink(t *testing.T) {
+	r := fake.New()
+	r.Add("local", nil)
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
+
+	plan, err := target.Sync(r, true)
+	if !assert.Nil(t, err) {
+		return
+	}
+	plan.Links = []ext.PlanAction{plan.Adds[0].LinkTo(r.MustGet("0"))}
+	plan.Adds = nil
+
+	if err := target.Apply(r, plan); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, len(r.MustList()))
+	assert.Equal(t, "line", r.MustGet("0").Message)
+	assert.Equal(t, "0", r.MustGet("0").Links["text"].ID)
+}
+
+func TestSyncDetached(t *testing.T) {
+	r := fake.New()
+	linked(r, "local", todo.Link{ID: "0"}.Detach())
+	linked(r, "gone", todo.Link{ID: "1"}.Detach())
+	target := &text{"text", "/tmp", false, [][]byte{[]byte("line")}, internal.PolicyRemote}
+
+	plan, err := target.Sync(r, false)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, plan.Empty())
+	assert.Equal(t, 2, len(r.MustList()))
+	assert.Equal(t, "local", r.MustGet("0").Message)
+	assert.Equal(t, todo.StateTodo, r.MustGet("1").State)
+}
@@ -2,28 +2,109 @@ package main
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/jwiklund/todo/todo"
 	"github.com/jwiklund/todo/view"
 )
 
 func externalCmd(t view.Todo, opts map[string]interface{}) {
+	if checking(opts) {
+		checkCmd(t, opts)
+		return
+	}
+	if ext, _ := opts["<external>"]; ext != nil {
+		link(t, opts["<id>"].(string), ext.(string))
+		return
+	}
+	if target, _ := opts["--move"]; target != nil {
+		if _, err := t.MoveLink(opts["<id>"].(string), target.(string), opts["--close"].(bool)); err != nil {
+			mainLog.Error(err.Error())
+			mainLog.Debugf("%+v", err)
+			return
+		}
+		list(t, false, "")
+		return
+	}
+	if opts["--unlink"].(bool) {
+		if err := t.Detach(opts["<id>"].(string)); err != nil {
+			mainLog.Error(err.Error())
+			mainLog.Debugf("%+v", err)
+			return
+		}
+		list(t, false, "")
+		return
+	}
 	task, err := t.Get(opts["<id>"].(string))
 	if err != nil {
 		mainLog.Info(err.Error())
 		mainLog.Debugf("%+v", err)
 		return
 	}
-	if ext, _ := opts["<external>"]; ext != nil {
-		if task.External() != "" {
-			mainLog.Info("Task already has external")
-			return
-		}
-		update(t, opts["<id>"].(string), nil, "", "external", ext.(string))
-	} else {
-		ext := task.External()
-		if ext == "" {
-			ext = "<none>"
+	if len(task.Links) == 0 {
+		fmt.Printf("(%s)   %s\n", task.ID, "<none>")
+	}
+	for _, name := range task.Linked() {
+		l, _ := task.Link(name)
+		fmt.Printf("(%s)   %s  %s%s\n", task.ID, name, l.ID, detached(l))
+	}
+}
+
+// checking true for ext check, docopt may match it as ext <id>
+func checking(opts map[string]interface{}) bool {
+	check, _ := opts["check"].(bool)
+	id, _ := opts["<id>"].(string)
+	return check || (id == "check" && opts["ext"] == true)
+}
+
+// todo [-v][-r <repo>] ext check [<external>]
+func checkCmd(t view.Todo, opts map[string]interface{}) {
+	name, _ := opts["<external>"].(string)
+	reports, err := t.Check(name)
+	if err != nil {
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		exitCode = 1
+		return
+	}
+	if len(reports) == 0 {
+		fmt.Println("No externals configured")
+	}
+	renderReports(reports, os.Stdout)
+	for _, report := range reports {
+		if report.Failed() {
+			exitCode = 1
 		}
-		fmt.Printf("(%s)   %s  %s\n", task.ID, ext, task.ExternalID())
 	}
 }
+
+// todo [-v][-r <repo>] link <id> <external>
+func linkCmd(t view.Todo, opts map[string]interface{}) {
+	link(t, opts["<id>"].(string), opts["<external>"].(string))
+}
+
+// todo [-v][-r <repo>] unlink <id> <external>
+func unlinkCmd(t view.Todo, opts map[string]interface{}) {
+	if err := t.RemoveLink(opts["<id>"].(string), opts["<external>"].(string)); err != nil {
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	list(t, false, "")
+}
+
+func link(t view.Todo, id, external string) {
+	if _, err := t.AddLink(id, external); err != nil {
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	list(t, false, "")
+}
+
+func detached(l todo.Link) string {
+	if l.Detached() {
+		return " (detached)"
+	}
+	return ""
+}
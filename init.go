@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jwiklund/todo/todo"
+)
+
+// todo [-v] init
+func initCmd(opts map[string]interface{}) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		mainLog.Error("Could not get working directory ", err.Error())
+		return
+	}
+	for _, name := range []string{projectConfig, projectRepo} {
+		if _, err := os.Stat(filepath.Join(cwd, name)); err == nil {
+			mainLog.Error("Todo list already exists in ", cwd)
+			return
+		}
+	}
+	cfg := fmt.Sprintf("repo = \"sqlite://%s\"\n", projectRepo)
+	if err := ioutil.WriteFile(filepath.Join(cwd, projectConfig), []byte(cfg), 0660); err != nil {
+		mainLog.Error("Could not write config ", err.Error())
+		return
+	}
+	repo, err := todo.RepoFromPath("sqlite://" + filepath.Join(cwd, projectRepo))
+	if err != nil {
+		mainLog.Error("Could not create list ", err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	repo.Close()
+	fmt.Printf("Created todo list in %s\n", cwd)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/BurntSushi/toml"
@@ -14,6 +15,7 @@ import (
 	_ "github.com/jwiklund/todo/ext/jira"
 	_ "github.com/jwiklund/todo/ext/text"
 	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/replica"
 	"github.com/jwiklund/todo/util"
 	"github.com/jwiklund/todo/view"
 	"github.com/pkg/errors"
@@ -23,46 +25,85 @@ var usage = `Todo list.
 
 Usage:
   todo -h
-  todo [(-c <cfg>) -va]
-  todo [(-c <cfg>) -va] list [<state>]
-  todo [(-c <cfg>) -v] add [(-a <key> <value>)] <message>...
-  todo [(-c <cfg>) -v] update <id> [(-a <key> <value>) (-s <state>) (-m <message>...)]
-  todo [(-c <cfg>) -vd] sync [<external>]
-  todo [(-c <cfg>) -v] show <id>
-  todo [(-c <cfg>) -v] do <id>
-  todo [(-c <cfg>) -v] wait <id>
-  todo [(-c <cfg>) -v] done <id>
-  todo [(-c <cfg>) -v] prio <id> [<prio>]
-  todo [(-c <cfg>) -v] ext <id> [<external>]
+  todo [(-c <cfg>) (-r <repo>) -va --all-repos]
+  todo [(-c <cfg>) (-r <repo>) -va --all-repos] list [<state>]
+  todo [(-c <cfg>) (-r <repo>) -v] add [(-a <key> <value>)] <message>...
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] update <id> [(-a <key> <value>) (-s <state>) (-m <message>...)]
+  todo [(-c <cfg>) (-r <repo>) -vd --all-repos] sync [--json] [<external>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] sync [--json] --plan <file> [<external>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] sync --apply <file>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] sync -i [<external>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] show <id>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] do <id>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] wait <id>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] done <id>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] prio <id> [<prio>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] comment <id> <text>...
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] worklog <id>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] ext check [<external>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] ext <id> [<external>]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] ext <id> --move <target> [--close]
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] ext <id> --unlink
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] link <id> <external>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] unlink <id> <external>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] move <id> <repo>
+  todo [(-c <cfg>) (-r <repo>) -v --all-repos] outbox [(drop <id>) | retry]
+  todo [-v] init
     
 Options:
-  -a          include all tasks [default false]
-  -v          be verbose (debug) [default false]
-  -c <cfg>    config [default ~/.todo.conf]
-  -d          dry run, only print what would be updated [default false]
+  -a           include all tasks [default false]
+  -v           be verbose (debug) [default false]
+  -c <cfg>     config [default .todo.conf in working directory or parents, else ~/.todo.conf]
+  -r <repo>    use the named repo from config [default repo]
+  --all-repos  use all configured repos, ids are prefixed with the repo name
+  -d           dry run, only print what would be updated [default false]
+  -i           interactive sync, confirm each change [default false]
+  --json       print the sync plan as json
+  --plan <file>   dry run, save the sync plan to file
+  --apply <file>  apply a saved sync plan, fails if tasks changed since
+  --move <target>  create the task in external target, detach it from its other externals
+  --close          close the task in the externals it is moved from instead of detaching
+  --unlink         detach the task from its externals, it is kept local
 `
 var mainLog = logrus.WithField("comp", "main")
 
+// exitCode set by commands that fail
+var exitCode = 0
+
 var cmds = map[string]func(view.Todo, map[string]interface{}){
-	"list":   listCmd,
-	"add":    addCmd,
-	"update": updateCmd,
-	"sync":   syncCmd,
-	"show":   showCmd,
-	"do":     doCmd,
-	"wait":   waitCmd,
-	"done":   doneCmd,
-	"prio":   prioCmd,
-	"ext":    externalCmd,
+	"list":    listCmd,
+	"add":     addCmd,
+	"update":  updateCmd,
+	"sync":    syncCmd,
+	"show":    showCmd,
+	"do":      doCmd,
+	"wait":    waitCmd,
+	"done":    doneCmd,
+	"prio":    prioCmd,
+	"comment": commentCmd,
+	"worklog": worklogCmd,
+	"ext":     externalCmd,
+	"outbox":  outboxCmd,
+	"link":    linkCmd,
+	"unlink":  unlinkCmd,
 }
 
 type config struct {
 	External []ext.ExternalConfig
 	Repo     string
+	Repos    map[string]string
 	State    string
+	Replica  string
+	Device   string
 }
 
 func main() {
+	// run last, after deferred unlocks
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 	opts, err := opt.Parse(usage, nil, true, "1.0", false)
 	if err != nil {
 		mainLog.Fatal(err)
@@ -73,6 +114,11 @@ func main() {
 	}
 	mainLog.Debug("Args ", sortOpts(opts))
 
+	if opts["init"].(bool) {
+		initCmd(opts)
+		return
+	}
+
 	config, err := readConfig(opts["-c"])
 	if err != nil {
 		mainLog.Error(err.Error())
@@ -80,7 +126,32 @@ func main() {
 		return
 	}
 
-	repo := repo(config.Repo)
+	uri, err := selectRepo(config, opts)
+	if err != nil {
+		mainLog.Error(err.Error())
+		return
+	}
+	mainLog.Debug("Active list ", uri)
+
+	if opts["sync"].(bool) {
+		locks, err := lockAll(lockPaths(config, uri, opts["--all-repos"].(bool)))
+		if err == util.ErrorLocked {
+			mainLog.Error("Another todo is syncing, try again later")
+			return
+		}
+		if err != nil {
+			mainLog.Error("Could not lock repository ", err.Error())
+			return
+		}
+		defer unlockAll(locks)
+	}
+
+	var repo todo.RepoBegin
+	if opts["--all-repos"].(bool) {
+		repo = allRepos(config)
+	} else {
+		repo = openRepo(config, uri)
+	}
 	if repo == nil {
 		return
 	}
@@ -92,7 +163,7 @@ func main() {
 		return
 	}
 
-	state, statePath, err := state(config.State)
+	state, statePath, err := state(statePath(config, opts))
 	if err != nil {
 		mainLog.Error(err.Error())
 		mainLog.Debug("%+v", err)
@@ -106,7 +177,16 @@ func main() {
 		return
 	}
 
-	cmd(todo, opts)
+	if !readOnly(opts) {
+		if err := todo.Retry(); err != nil {
+			mainLog.Debugf("Could not retry outbox %+v", err)
+		}
+	}
+	if opts["move"].(bool) {
+		moveCmd(todo, config, opts)
+	} else {
+		cmd(todo, opts)
+	}
 	err = saveState(statePath, todo.State())
 	if err != nil {
 		mainLog.Errorf("%+v", err)
@@ -115,6 +195,13 @@ func main() {
 	mainLog.Debugf("Close returned %v", todo.Close())
 }
 
+// readOnly true if the command should not write
+func readOnly(opts map[string]interface{}) bool {
+	d, _ := opts["-d"].(bool)
+	_, plan := opts["--plan"].(string)
+	return d || plan || checking(opts)
+}
+
 func sortOpts(opts map[string]interface{}) string {
 	res := bytes.Buffer{}
 	var keys []string
@@ -131,10 +218,133 @@ func sortOpts(opts map[string]interface{}) string {
 	return res.String()
 }
 
-func repo(path string) todo.RepoBegin {
+func repoPath(path string) string {
 	if path == "" {
-		path = "sqlite://~/.todo.db"
+		return "sqlite://~/.todo.db"
+	}
+	return path
+}
+
+// selectRepo return the uri of the repo named by -r or the default repo
+func selectRepo(c config, opts map[string]interface{}) (string, error) {
+	name, ok := opts["-r"].(string)
+	if !ok {
+		return repoPath(c.Repo), nil
+	}
+	return repoURI(c, name)
+}
+
+func repoURI(c config, name string) (string, error) {
+	if uri, ok := c.Repos[name]; ok {
+		return uri, nil
+	}
+	if name == "default" {
+		return repoPath(c.Repo), nil
+	}
+	return "", errors.New("Unknown repo " + name)
+}
+
+// openRepo open the repo at uri, the default repo is replicated if configured
+func openRepo(c config, uri string) todo.RepoBegin {
+	r := repo(uri)
+	if r == nil || c.Replica == "" || uri != repoPath(c.Repo) {
+		return r
+	}
+	replicated, err := replica.New(r, util.Expand(c.Replica), c.Device)
+	if err != nil {
+		r.Close()
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		return nil
+	}
+	return replicated
+}
+
+// allRepos open the default and all named repos as one, ordered by name with
+// the default repo first
+func allRepos(c config) todo.RepoBegin {
+	var names []string
+	for name := range c.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var named []view.Named
+	open := func(name, uri string) bool {
+		r := openRepo(c, uri)
+		if r == nil {
+			for _, n := range named {
+				n.Repo.Close()
+			}
+			return false
+		}
+		named = append(named, view.Named{Name: name, Repo: r})
+		return true
+	}
+	defaultURI := repoPath(c.Repo)
+	defaultName := "default"
+	for _, name := range names {
+		if c.Repos[name] == defaultURI {
+			defaultName = name
+			break
+		}
+	}
+	// the default repo goes first, new tasks are added there
+	if !open(defaultName, defaultURI) {
+		return nil
 	}
+	for _, name := range names {
+		if c.Repos[name] != defaultURI && !open(name, c.Repos[name]) {
+			return nil
+		}
+	}
+	return view.Merge(named)
+}
+
+// lockPaths the sync locks of the repo at uri, or of all repos, sorted so
+// that they are always taken in the same order
+func lockPaths(c config, uri string, all bool) []string {
+	uris := []string{uri}
+	if all {
+		uris = []string{repoPath(c.Repo)}
+		for _, uri := range c.Repos {
+			uris = append(uris, uri)
+		}
+	}
+	seen := map[string]bool{}
+	var paths []string
+	for _, uri := range uris {
+		path := todo.LockPath(repoPath(uri))
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// lockAll take the locks in order, none is held if one fails
+func lockAll(paths []string) ([]util.Lock, error) {
+	var locks []util.Lock
+	for _, path := range paths {
+		lock, err := util.TryLock(path)
+		if err != nil {
+			unlockAll(locks)
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+func unlockAll(locks []util.Lock) {
+	for i := len(locks) - 1; i >= 0; i-- {
+		locks[i].Unlock()
+	}
+}
+
+func repo(path string) todo.RepoBegin {
+	path = repoPath(path)
 	repo, err := todo.RepoFromPath(path)
 	if err != nil {
 		mainLog.Error("Invalid repository path ", path, " ", err.Error())
@@ -144,11 +354,25 @@ func repo(path string) todo.RepoBegin {
 	return repo
 }
 
-func state(path string) (view.State, string, error) {
-	var state view.State
+// statePath the state file of the relative ids of the repo selected by -r or
+// --all-repos, each has its own so that ids listed in one are not used in
+// another
+func statePath(c config, opts map[string]interface{}) string {
+	path := c.State
 	if path == "" {
 		path = "~/.todo.state"
 	}
+	if all, _ := opts["--all-repos"].(bool); all {
+		return path + ".all"
+	}
+	if name, ok := opts["-r"].(string); ok && name != "default" {
+		return path + "." + name
+	}
+	return path
+}
+
+func state(path string) (view.State, string, error) {
+	var state view.State
 	path = util.Expand(path)
 	stat, err := os.Stat(path)
 	if err != nil {
@@ -173,26 +397,39 @@ func state(path string) (view.State, string, error) {
 }
 
 func saveState(path string, state view.State) error {
-	f, e := os.Create(path)
-	if e != nil {
-		return errors.Wrap(e, "Could not write state")
-	}
-	encoder := toml.NewEncoder(f)
+	bs := bytes.Buffer{}
+	encoder := toml.NewEncoder(&bs)
 	err := encoder.Encode(state)
 	if err != nil {
-		f.Close()
-		return err
+		return errors.Wrap(err, "Could not encode state")
 	}
-	return f.Close()
+	return errors.Wrap(util.WriteFile(path, bs.Bytes(), 0660), "Could not write state")
 }
 
+// readConfig read config from path, or from the project list found from the
+// working directory, or from ~/.todo.conf
 func readConfig(path interface{}) (config, error) {
-	p := "~/.todo.conf"
-	c := config{}
 	if path != nil {
-		p = path.(string)
+		return readConfigFile(util.Expand(path.(string)))
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return config{}, errors.Wrap(err, "Could not get working directory")
+	}
+	dir, name := discover(cwd)
+	switch name {
+	case projectConfig:
+		c, err := readConfigFile(filepath.Join(dir, projectConfig))
+		return projectDefaults(c, dir), err
+	case projectRepo:
+		mainLog.Debug("Using project list without config in ", dir)
+		return projectDefaults(config{}, dir), nil
 	}
-	p = util.Expand(p)
+	return readConfigFile(util.Expand("~/.todo.conf"))
+}
+
+func readConfigFile(p string) (config, error) {
+	c := config{}
 	stat, err := os.Stat(p)
 	if err != nil {
 		mainLog.Debug("Config file not found, using defaults", err)
@@ -207,6 +444,7 @@ func readConfig(path interface{}) (config, error) {
 		return c, errors.Wrap(e, "Could not open config file")
 	}
 	defer f.Close()
+	mainLog.Debug("Using config ", p)
 
 	return readConfigToml(f)
 }
@@ -225,21 +463,44 @@ func readConfigToml(r io.Reader) (config, error) {
 			} else {
 				return c, errors.New("Invalid config, 'repo' should be uri")
 			}
+		} else if key == "repos" {
+			repos, ok := value.(map[string]interface{})
+			if !ok {
+				return c, errors.New("Invalid config, 'repos' should be table of name = uri")
+			}
+			c.Repos = map[string]string{}
+			for name, uri := range repos {
+				if u, ok := uri.(string); ok {
+					c.Repos[name] = u
+				} else {
+					return c, errors.New("Invalid config, repo '" + name + "' should be uri")
+				}
+			}
+		} else if key == "replica" {
+			if dir, ok := value.(string); ok {
+				c.Replica = dir
+			} else {
+				return c, errors.New("Invalid config, 'replica' should be a directory")
+			}
+		} else if key == "device" {
+			if device, ok := value.(string); ok {
+				c.Device = device
+			} else {
+				return c, errors.New("Invalid config, 'device' should be a name")
+			}
 		} else {
 			if values, ok := value.(map[string]interface{}); ok {
 				e := ext.ExternalConfig{
 					ID:    key,
 					Extra: map[string]string{},
 				}
-				for valueKey, valueValue := range values {
-					if valueKey == "uri" {
-						e.URI = valueValue.(string)
-					} else if valueKey == "type" {
-						e.Type = valueValue.(string)
-					} else {
-						e.Extra[valueKey] = valueValue.(string)
-					}
+				if err := flatten("", values, e.Extra); err != nil {
+					return c, err
 				}
+				e.URI = e.Extra["uri"]
+				e.Type = e.Extra["type"]
+				delete(e.Extra, "uri")
+				delete(e.Extra, "type")
 				if e.ID == "" || e.Type == "" || e.URI == "" {
 					return c, errors.New("Invalid config, id, type and uri is required for '" + key + "' ")
 				}
@@ -253,6 +514,24 @@ func readConfigToml(r io.Reader) (config, error) {
 
 }
 
+// flatten external config values into extra, nested tables such as
+// [jira.field.prio] become dotted keys (field.prio.remote)
+func flatten(prefix string, values map[string]interface{}, extra map[string]string) error {
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			extra[prefix+key] = v
+		case map[string]interface{}:
+			if err := flatten(prefix+key+".", v, extra); err != nil {
+				return err
+			}
+		default:
+			return errors.New("Invalid config, '" + prefix + key + "' should be a string or table")
+		}
+	}
+	return nil
+}
+
 func cmd(t view.Todo, opts map[string]interface{}) {
 	for key, cmd := range cmds {
 		if opts[key].(bool) {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/jwiklund/todo/view"
+)
+
+// todo [-v][-r <repo>] move <id> <repo>
+func moveCmd(t view.Todo, c config, opts map[string]interface{}) {
+	name := opts["<repo>"].(string)
+	uri, err := repoURI(c, name)
+	if err != nil {
+		mainLog.Error(err.Error())
+		return
+	}
+	target := openRepo(c, uri)
+	if target == nil {
+		return
+	}
+	defer target.Close()
+	if _, err := t.Move(opts["<id>"].(string), name, target); err != nil {
+		mainLog.Error("Could not move task ", err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	list(t, false, "")
+}
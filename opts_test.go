@@ -73,6 +73,43 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, "cfg", opts["-c"])
 }
 
+func TestRepo(t *testing.T) {
+	opts := parse(t, "-r", "work", "add", "message")
+	assert.Equal(t, "work", opts["-r"])
+	opts = parse(t, "--all-repos", "list")
+	assert.Equal(t, true, opts["--all-repos"])
+	opts = parse(t, "move", "1", "work")
+	assert.Equal(t, true, opts["move"])
+	assert.Equal(t, "1", opts["<id>"])
+	assert.Equal(t, "work", opts["<repo>"])
+	assert.Equal(t, nil, opts["-r"])
+}
+
+func TestStatePath(t *testing.T) {
+	c := config{State: "/p/.todo.state"}
+	assert.Equal(t, "/p/.todo.state", statePath(c, parse(t, "list")))
+	assert.Equal(t, "/p/.todo.state", statePath(c, parse(t, "-r", "default", "list")))
+	assert.Equal(t, "/p/.todo.state.work", statePath(c, parse(t, "-r", "work", "list")))
+	assert.Equal(t, "/p/.todo.state.all", statePath(c, parse(t, "--all-repos", "list")))
+	assert.Equal(t, "~/.todo.state", statePath(config{}, parse(t, "list")))
+}
+
+func TestLockPaths(t *testing.T) {
+	c := config{Repo: "sqlite:///p/todo.db", Repos: map[string]string{
+		"work":    "sqlite:///p/work.db",
+		"default": "sqlite:///p/todo.db",
+		"a":       "sqlite:///p/a.db",
+	}}
+	assert.Equal(t, []string{"/p/work.db.lock"}, lockPaths(c, "sqlite:///p/work.db", false))
+	assert.Equal(t, []string{"/p/a.db.lock", "/p/todo.db.lock", "/p/work.db.lock"},
+		lockPaths(c, "sqlite:///p/work.db", true))
+}
+
+func TestInit(t *testing.T) {
+	opts := parse(t, "init")
+	assert.Equal(t, true, opts["init"])
+}
+
 func TestOpts(t *testing.T) {
 	opts := parse(t, "-a", "-v")
 	assert.Equal(t, true, opts["-a"])
@@ -81,3 +118,58 @@ func TestOpts(t *testing.T) {
 	assert.Equal(t, false, opts["-a"])
 	assert.Equal(t, false, opts["-v"])
 }
+
+func TestSyncPlan(t *testing.T) {
+	opts := parse(t, "sync", "--plan", "plan.json", "jira")
+	assert.Equal(t, "plan.json", opts["--plan"])
+	assert.Equal(t, "jira", opts["<external>"])
+	opts = parse(t, "sync", "--apply", "plan.json")
+	assert.Equal(t, "plan.json", opts["--apply"])
+	opts = parse(t, "-d", "sync", "--json")
+	assert.Equal(t, true, opts["--json"])
+	expectParseFailure(t, "--apply takes no external", "sync", "--apply", "plan.json", "jira")
+}
+
+func TestSyncInteractive(t *testing.T) {
+	opts := parse(t, "sync", "-i", "jira")
+	assert.Equal(t, true, opts["-i"])
+	assert.Equal(t, "jira", opts["<external>"])
+}
+
+func TestOutbox(t *testing.T) {
+	opts := parse(t, "outbox")
+	assert.Equal(t, true, opts["outbox"])
+	opts = parse(t, "outbox", "drop", "1")
+	assert.Equal(t, true, opts["drop"])
+	assert.Equal(t, "1", opts["<id>"])
+	opts = parse(t, "outbox", "retry")
+	assert.Equal(t, true, opts["retry"])
+}
+
+func TestExtMove(t *testing.T) {
+	opts := parse(t, "ext", "1", "--move", "jira", "--close")
+	assert.Equal(t, "jira", opts["--move"])
+	assert.Equal(t, true, opts["--close"])
+	assert.Nil(t, opts["<external>"])
+	opts = parse(t, "ext", "1", "--unlink")
+	assert.Equal(t, true, opts["--unlink"])
+	expectParseFailure(t, "--unlink takes no external", "ext", "1", "--unlink", "jira")
+}
+
+func TestExtCheck(t *testing.T) {
+	opts := parse(t, "ext", "check", "jira")
+	assert.True(t, checking(opts))
+	assert.Equal(t, "jira", opts["<external>"])
+	opts = parse(t, "ext", "check")
+	assert.True(t, checking(opts))
+	opts = parse(t, "ext", "1")
+	assert.False(t, checking(opts))
+	assert.Equal(t, "1", opts["<id>"])
+}
+
+func TestComment(t *testing.T) {
+	expectParseFailure(t, "comment requires text", "comment", "1")
+	opts := parse(t, "comment", "1", "looks", "good")
+	assert.Equal(t, true, opts["comment"])
+	assert.Equal(t, []string{"looks", "good"}, opts["<text>"])
+}
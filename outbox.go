@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jwiklund/todo/view"
+)
+
+// todo [-v][-r <repo>] outbox
+// todo [-v][-r <repo>] outbox drop <id>
+// todo [-v][-r <repo>] outbox retry
+func outboxCmd(t view.Todo, opts map[string]interface{}) {
+	if opts["drop"].(bool) {
+		if err := t.Drop(opts["<id>"].(string)); err != nil {
+			mainLog.Error(err.Error())
+			mainLog.Debugf("%+v", err)
+			return
+		}
+	}
+	// retry already done before running the command
+	tasks, err := t.Outbox()
+	if err != nil {
+		mainLog.Error("Couldn't list tasks ", err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	renderOutbox(tasks, os.Stdout)
+}
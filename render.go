@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
+	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/todo"
 )
 
@@ -27,20 +31,245 @@ func Prio(prio int) string {
 
 func renderList(ts []todo.Task, out io.Writer) {
 	w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
-	for _, task := range ts {
-		fmt.Fprintf(w, "(%s)\t%s\t%s\t%s\n", task.ID, Prio(task.Prio()), task.State.String(), task.Message)
+	ordered, depths := nested(ts)
+	for i, task := range ordered {
+		indent := strings.Repeat("  ", depths[i])
+		fmt.Fprintf(w, "(%s)\t%s\t%s\t%s%s\n", task.ID, Prio(task.Prio()), task.State.String(), indent, task.Message)
 	}
 	w.Flush()
 }
 
+// nested tasks with subtasks following their parent, and the depth of each.
+// The parent attribute is the uuid of the parent or the id of one of its
+// links, such as a jira issue key. Task ids are relative to the view and are
+// not used.
+func nested(ts []todo.Task) ([]todo.Task, []int) {
+	byID := map[string]int{}
+	for i, task := range ts {
+		for _, name := range task.Linked() {
+			if l, _ := task.Link(name); l.ID != "" {
+				byID[l.ID] = i
+			}
+		}
+	}
+	for i, task := range ts {
+		if task.UUID != "" {
+			byID[task.UUID] = i
+		}
+	}
+	children := map[int][]int{}
+	var roots []int
+	for i, task := range ts {
+		parent, ok := byID[task.Attr["parent"]]
+		if ok && parent != i && task.Attr["parent"] != "" {
+			children[parent] = append(children[parent], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	var ordered []todo.Task
+	var depths []int
+	visited := map[int]bool{}
+	var visit func(i, depth int)
+	visit = func(i, depth int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		ordered = append(ordered, ts[i])
+		depths = append(depths, depth)
+		for _, child := range children[i] {
+			visit(child, depth+1)
+		}
+	}
+	for _, i := range roots {
+		visit(i, 0)
+	}
+	// parents of each other
+	for i := range ts {
+		visit(i, 0)
+	}
+	return ordered, depths
+}
+
 func renderOne(task todo.Task, out io.Writer) {
 	w := tabwriter.NewWriter(out, 6, 8, 2, ' ', 0)
 	fmt.Fprintf(w, "(%s)\t%s\t%s\t%s\n", task.ID, Prio(task.Prio()), task.State.String(), task.Message)
-	for key, value := range task.Attr {
-		fmt.Fprintf(w, "\t%s\t%s\n", key, value)
+	if task.UUID != "" {
+		fmt.Fprintf(w, "\t%s\t%s\n", "uuid", task.UUID)
+	}
+	for _, name := range task.Linked() {
+		l, _ := task.Link(name)
+		fmt.Fprintf(w, "\t%s\t%s %s%s\n", "link", name, l.ID, detached(l))
+	}
+	var keys []string
+	for key := range task.Attr {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// such as a note synced from a description
+		value := strings.Replace(task.Attr[key], "\r\n", "\n", -1)
+		lines := strings.Split(strings.TrimRight(value, "\n"), "\n")
+		fmt.Fprintf(w, "\t%s\t%s\n", key, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "\t\t%s\n", line)
+		}
 	}
 	w.Flush()
 }
 func render(task todo.Task) string {
 	return task.String()
 }
+
+// planKind a kind of planned action
+type planKind struct {
+	name    string
+	actions *[]ext.PlanAction
+}
+
+func planKinds(plan *ext.Plan) []planKind {
+	return []planKind{
+		{"add", &plan.Adds},
+		{"link", &plan.Links},
+		{"close", &plan.Closes},
+		{"update", &plan.Updates},
+		{"revive", &plan.Revives},
+	}
+}
+
+// renderPlans render what a sync will change, one line per changed field
+func renderPlans(plans []ext.Plan, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
+	for i := range plans {
+		if plans[i].Cached != nil {
+			fmt.Fprintf(w, "%s\toffline, from cache of %s\n", plans[i].External, cachedAt(*plans[i].Cached, time.Now()))
+		}
+		for _, kind := range planKinds(&plans[i]) {
+			for _, action := range *kind.actions {
+				renderAction(plans[i].External, kind.name, action, w)
+			}
+		}
+	}
+	w.Flush()
+}
+
+// renderDescriptions render what the externals know about a task
+func renderDescriptions(ds []ext.Description, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
+	for _, d := range ds {
+		header := d.External + " " + d.ID
+		if d.Cached != nil {
+			header += " (offline, from cache of " + cachedAt(*d.Cached, time.Now()) + ")"
+		}
+		fmt.Fprintln(w, header)
+		var keys []string
+		for key := range d.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "\t%s\t%s\n", key, d.Fields[key])
+		}
+	}
+	w.Flush()
+}
+
+// cachedAt when something was cached and how long ago, in minutes
+func cachedAt(saved, now time.Time) string {
+	age := now.Sub(saved).Truncate(time.Minute).String()
+	if strings.HasSuffix(age, "m0s") {
+		age = strings.TrimSuffix(age, "0s")
+	}
+	return saved.Local().Format("2006-01-02 15:04") + ", " + age + " ago"
+}
+
+// renderResults render what a sync changed per external
+func renderResults(results []ext.Result, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(w, "%s\tfailed\t%v\n", result.Plan.External, result.Err)
+			continue
+		}
+		p := result.Plan
+		fmt.Fprintf(w, "%s\tadded %d\tclosed %d\tupdated %d\trevived %d\n",
+			p.External, len(p.Adds)+len(p.Links), len(p.Closes), len(p.Updates), len(p.Revives))
+	}
+	w.Flush()
+}
+
+func renderAction(external, kind string, action ext.PlanAction, w io.Writer) {
+	if action.Push {
+		kind = kind + "+push"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", external, kind, action.ExternalID, action.After.Message)
+	for _, change := range action.Changes {
+		fmt.Fprintf(w, "\t\t\t%s: %s -> %s\n", change.Field, change.From, change.To)
+	}
+	for _, c := range action.Conflicts {
+		fmt.Fprintf(w, "\t\t\tconflict %s: local %s, remote %s, keep %s\n", c.Field, c.Local, c.Remote, c.Kept)
+	}
+}
+
+// reason the write of a task in the outbox failed
+func reason(task todo.Task) string {
+	p, _ := ext.Queued(task)
+	return p.Reason
+}
+
+// renderOutbox render tasks waiting to be written to their external
+func renderOutbox(ts []todo.Task, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
+	for _, task := range ts {
+		fmt.Fprintf(w, "(%s)\t%s\t%s\t%s\n", task.ID, strings.Join(task.Linked(), ","), task.Message, reason(task))
+	}
+	w.Flush()
+}
+
+// renderReports render what each external supports and the checks of it
+func renderReports(reports []ext.Report, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 2, ' ', 0)
+	yes := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s)\n", report.External, report.Type)
+		if c := report.Capabilities; c != nil {
+			var states []string
+			for _, state := range c.States {
+				states = append(states, state.String())
+			}
+			fields := []string{"message", "state"}
+			for _, m := range c.Fields {
+				fields = append(fields, m.Local+" "+direction(m.Direction)+" "+m.Remote)
+			}
+			fmt.Fprintf(w, "\tstates\t%s\n", strings.Join(states, ", "))
+			fmt.Fprintf(w, "\tfields\t%s\n", strings.Join(fields, ", "))
+			fmt.Fprintf(w, "\tcreate\t%s\n", yes(c.Create))
+			fmt.Fprintf(w, "\tdelete\t%s\n", yes(c.Delete))
+			fmt.Fprintf(w, "\ttwo-way\t%s\n", yes(c.TwoWay))
+		}
+		for _, d := range report.Diagnostics {
+			fmt.Fprintf(w, "\t%s\t%s\n", d.Severity, d.Message)
+			if d.Fix != "" {
+				fmt.Fprintf(w, "\t\tfix: %s\n", d.Fix)
+			}
+		}
+	}
+	w.Flush()
+}
+
+func direction(d ext.Direction) string {
+	switch d {
+	case ext.DirectionPush:
+		return "->"
+	case ext.DirectionPull:
+		return "<-"
+	}
+	return "<->"
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"bytes"
 
+	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,6 +35,17 @@ func TestRenderOneAttr(t *testing.T) {
 	assert.Equal(t, "(0)   none  done  message\n      key   value\n", bs.String())
 }
 
+func TestRenderOneUUID(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderOne(todo.Task{
+		ID:      "0",
+		UUID:    "8c1d",
+		State:   todo.StateTodo,
+		Message: "message",
+	}, &bs)
+	assert.Equal(t, "(0)   none  todo  message\n      uuid  8c1d\n", bs.String())
+}
+
 func TestRenderList(t *testing.T) {
 	bs := bytes.Buffer{}
 	renderList([]todo.Task{todo.Task{
@@ -41,3 +55,110 @@ func TestRenderList(t *testing.T) {
 	}}, &bs)
 	assert.Equal(t, "(0)   none  todo  message\n", bs.String())
 }
+
+func TestRenderPlans(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderPlans([]ext.Plan{{
+		External: "jira",
+		Updates: []ext.PlanAction{{
+			ExternalID: "P-1",
+			After:      todo.Task{Message: "new"},
+			Changes:    []ext.FieldChange{{Field: "message", From: "old", To: "new"}},
+		}},
+	}}, &bs)
+	assert.Equal(t, "jira  update P-1   new\n                   message: old -> new\n", bs.String())
+}
+
+func TestRenderDescriptions(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderDescriptions([]ext.Description{{
+		External: "jira",
+		ID:       "P-1",
+		Fields:   map[string]string{"status": "To Do", "transitions": "In Progress, Done"},
+	}}, &bs)
+	assert.Equal(t, "jira P-1\n      status      To Do\n      transitions In Progress, Done\n", bs.String())
+}
+
+func TestCachedAt(t *testing.T) {
+	saved := time.Date(2017, 1, 1, 12, 0, 0, 0, time.Local)
+	assert.Equal(t, "2017-01-01 12:00, 5m ago", cachedAt(saved, saved.Add(5*time.Minute+10*time.Second)))
+	assert.Equal(t, "2017-01-01 12:00, 2h30m ago", cachedAt(saved, saved.Add(150*time.Minute)))
+}
+
+func TestRenderResults(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderResults([]ext.Result{
+		{Plan: ext.Plan{External: "jira"}, Err: errors.New("down")},
+		{Plan: ext.Plan{External: "text", Adds: []ext.PlanAction{{}}}},
+	}, &bs)
+	assert.Equal(t, "jira  failed  down\ntext  added 1 closed 0 updated 0 revived 0\n", bs.String())
+}
+
+func TestRenderReports(t *testing.T) {
+	out := bytes.Buffer{}
+	renderReports([]ext.Report{{
+		External: "jira",
+		Type:     "jira",
+		Capabilities: &ext.Capabilities{
+			States: []todo.State{todo.StateTodo, todo.StateDone},
+			Fields: []ext.FieldMap{{Local: "prio", Remote: "priority", Direction: ext.DirectionPull}},
+			Create: true,
+			TwoWay: true,
+		},
+		Diagnostics: []ext.Diagnostic{
+			{Severity: ext.SeverityOK, Message: "connected"},
+			{Severity: ext.SeverityWarning, Message: "no done_transition", Fix: "set done_transition"},
+		},
+	}}, &out)
+	assert.Equal(t, `jira (jira)
+      states   todo, done
+      fields   message, state, prio <- priority
+      create   yes
+      delete   no
+      two-way  yes
+      ok       connected
+      warning  no done_transition
+               fix: set done_transition
+`, out.String())
+}
+
+func TestRenderOneNote(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderOne(todo.Task{
+		ID:      "0",
+		State:   todo.StateTodo,
+		Message: "message",
+		Attr: map[string]string{
+			"note": "first\r\nsecond\r\n",
+			"due":  "2017-01-01",
+		},
+	}, &bs)
+	assert.Equal(t, "(0)   none  todo  message\n      due   2017-01-01\n      note  first\n            second\n", bs.String())
+}
+
+func TestRenderListNested(t *testing.T) {
+	bs := bytes.Buffer{}
+	renderList([]todo.Task{
+		{ID: "0", UUID: "u0", State: todo.StateTodo, Message: "sub", Attr: map[string]string{"parent": "P-1"}},
+		{ID: "1", State: todo.StateTodo, Message: "other", Attr: map[string]string{"parent": "2"}},
+		{ID: "2", State: todo.StateTodo, Message: "story", Links: map[string]todo.Link{"jira": {ID: "P-1"}}},
+		{ID: "3", State: todo.StateTodo, Message: "subsub", Attr: map[string]string{"parent": "u0"}},
+	}, &bs)
+	// the parent 2 of other is a task id, not a parent
+	assert.Equal(t, "(1)   none  todo  other\n(2)   none  todo  story\n(0)   none  todo    sub\n(3)   none  todo      subsub\n", bs.String())
+}
+
+func TestRenderWorklog(t *testing.T) {
+	bs := bytes.Buffer{}
+	start := time.Date(2017, 1, 2, 10, 0, 0, 0, time.Local)
+	task := todo.Task{Links: map[string]todo.Link{"jira": {ID: "P-1"}}}
+	task.StartWork(start)
+	task.StopWork(start.Add(90 * time.Minute))
+	task.SetLink("jira", task.Links["jira"].Log(task.Worklog()[0], "1"))
+	task.StartWork(start.Add(2 * time.Hour))
+	task.StopWork(start.Add(150 * time.Minute))
+	renderWorklog(task, &bs)
+	assert.Equal(t, "2017-01-02 10:00  11:30  1h30m0s  jira\n"+
+		"2017-01-02 12:00  12:30  30m0s    pending\n"+
+		"total                    2h0m0s\n", bs.String())
+}
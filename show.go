@@ -14,4 +14,5 @@ func showCmd(t view.Todo, opts map[string]interface{}) {
 		mainLog.Debugf("%+v", err)
 	}
 	renderOne(task, os.Stdout)
+	renderDescriptions(t.Describe(task), os.Stdout)
 }
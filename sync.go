@@ -1,12 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jwiklund/todo/ext"
 	_ "github.com/jwiklund/todo/ext/text"
 	"github.com/jwiklund/todo/view"
+	"github.com/pkg/errors"
 )
 
 // todo [-v][-r <repo>] sync [<external>]
+// todo [-v][-r <repo>] sync --plan <file> [<external>]
+// todo [-v][-r <repo>] sync --apply <file>
+// todo [-v][-r <repo>] sync -i [<external>]
 func syncCmd(t view.Todo, opts map[string]interface{}) {
+	if path, ok := opts["--apply"].(string); ok {
+		applyPlans(t, path)
+		return
+	}
 	external := ""
 	if s := opts["<external>"]; s != nil {
 		external = s.(string)
@@ -15,21 +33,178 @@ func syncCmd(t view.Todo, opts map[string]interface{}) {
 	if b := opts["-d"]; b != nil {
 		dryRun = b.(bool)
 	}
+	planPath, savePlan := opts["--plan"].(string)
+	interactive, _ := opts["-i"].(bool)
+	if savePlan || interactive {
+		dryRun = true
+	}
+	asJSON, _ := opts["--json"].(bool)
+
+	var results []ext.Result
 	if external != "" {
-		err := t.Sync(external, dryRun)
+		plan, err := t.Sync(external, dryRun)
 		if err != nil {
-			mainLog.Errorf("Failed to sync external %s %v", external, err)
-			mainLog.Debugf("%+v", err)
-			return
+			plan.External = external
 		}
+		results = append(results, ext.Result{Plan: plan, Err: err})
 	} else {
-		err := t.SyncAll(dryRun)
+		results = t.SyncAll(dryRun)
+	}
+	var plans []ext.Plan
+	for _, result := range results {
+		if result.Err != nil {
+			exitCode = 1
+			mainLog.Errorf("Failed to sync external %s %v", result.Plan.External, result.Err)
+			mainLog.Debugf("%+v", result.Err)
+			continue
+		}
+		plans = append(plans, result.Plan)
+	}
+
+	if interactive {
+		accepted, err := confirm(t, plans, ext.Stdin, os.Stdout)
 		if err != nil {
+			mainLog.Error(err.Error())
+			mainLog.Debugf("%+v", err)
+			return
+		}
+		if err := t.Apply(accepted); err != nil {
+			exitCode = 1
 			mainLog.Errorf("Failed to sync external %v", err)
 			mainLog.Debugf("%+v", err)
 			return
 		}
+		list(t, false, "")
+		return
+	}
+	if savePlan {
+		if err := savePlans(planPath, plans); err != nil {
+			mainLog.Error(err.Error())
+			mainLog.Debugf("%+v", err)
+			return
+		}
+	}
+	if asJSON {
+		bs, _ := json.MarshalIndent(plans, "", "  ")
+		os.Stdout.Write(append(bs, '\n'))
+		return
+	}
+	if dryRun {
+		renderPlans(plans, os.Stdout)
+		return
 	}
 
+	renderResults(results, os.Stdout)
 	list(t, false, "")
 }
+
+func applyPlans(t view.Todo, path string) {
+	plans, err := loadPlans(path)
+	if err != nil {
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	if err := t.Apply(plans); err != nil {
+		exitCode = 1
+		mainLog.Errorf("Failed to apply plan %v", err)
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	list(t, false, "")
+}
+
+func savePlans(path string, plans []ext.Plan) error {
+	bs, err := json.MarshalIndent(plans, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Could not encode plan")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, bs, 0660), "Could not write plan")
+}
+
+func loadPlans(path string) ([]ext.Plan, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read plan")
+	}
+	var plans []ext.Plan
+	if err := json.Unmarshal(bs, &plans); err != nil {
+		return nil, errors.Wrap(err, "Could not decode plan")
+	}
+	return plans, nil
+}
+
+// confirm walk through the planned changes, return the accepted ones
+func confirm(t view.Todo, plans []ext.Plan, in io.Reader, out io.Writer) ([]ext.Plan, error) {
+	reader := bufio.NewReader(in)
+	all := map[string]bool{}
+	quit := false
+	var res []ext.Plan
+	for i := range plans {
+		accepted := ext.Plan{External: plans[i].External, Fingerprint: plans[i].Fingerprint}
+		acceptedKinds := planKinds(&accepted)
+		for k, kind := range planKinds(&plans[i]) {
+			for _, action := range *kind.actions {
+				if quit {
+					break
+				}
+				if all[kind.name] {
+					*acceptedKinds[k].actions = append(*acceptedKinds[k].actions, action)
+					continue
+				}
+				w := tabwriter.NewWriter(out, 6, 8, 1, ' ', 0)
+				renderAction(plans[i].External, kind.name, action, w)
+				w.Flush()
+			prompt:
+				for {
+					if kind.name == "add" {
+						fmt.Fprintf(out, "Accept [y]es, [n]o, [a]ll %ss, [l]ink <id>, [q]uit? ", kind.name)
+					} else {
+						fmt.Fprintf(out, "Accept [y]es, [n]o, [a]ll %ss, [q]uit? ", kind.name)
+					}
+					line, err := reader.ReadString('\n')
+					if err == io.EOF {
+						quit = true
+						break
+					}
+					if err != nil {
+						return nil, errors.Wrap(err, "Could not read answer")
+					}
+					answer := strings.Fields(line)
+					if len(answer) == 0 {
+						continue
+					}
+					switch answer[0] {
+					case "y":
+						*acceptedKinds[k].actions = append(*acceptedKinds[k].actions, action)
+						break prompt
+					case "n":
+						break prompt
+					case "a":
+						all[kind.name] = true
+						*acceptedKinds[k].actions = append(*acceptedKinds[k].actions, action)
+						break prompt
+					case "q":
+						quit = true
+						break prompt
+					case "l":
+						if kind.name != "add" || len(answer) != 2 {
+							continue
+						}
+						link, err := t.Link(action, answer[1])
+						if err != nil {
+							fmt.Fprintf(out, "Could not link to %s: %v\n", answer[1], err)
+							continue
+						}
+						accepted.Links = append(accepted.Links, link)
+						break prompt
+					}
+				}
+			}
+		}
+		if !accepted.Empty() {
+			res = append(res, accepted)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/jwiklund/todo/view"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirm(t *testing.T) {
+	r := fake.New()
+	r.Add("existing", nil)
+	exts, _ := ext.New(nil)
+	v, _ := view.New(r, exts, view.State{})
+	v.List(func(todo.Task) bool { return true })
+
+	add := func(id string) ext.PlanAction {
+		return ext.PlanAction{
+			ExternalID: id,
+			After: todo.Task{
+				Message: "remote " + id,
+				State:   todo.StateTodo,
+				Attr:    map[string]string{},
+				Links:   map[string]todo.Link{"jira": {ID: id}},
+			},
+		}
+	}
+	plans := []ext.Plan{{
+		External: "jira",
+		Adds:     []ext.PlanAction{add("P-1"), add("P-2"), add("P-3"), add("P-4")},
+		Closes:   []ext.PlanAction{{ExternalID: "P-5"}},
+	}}
+
+	out := bytes.Buffer{}
+	accepted, err := confirm(v, plans, strings.NewReader("y\nn\nl 0\na\nq\n"), &out)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 1, len(accepted))
+	assert.Equal(t, []ext.PlanAction{add("P-1"), add("P-4")}, accepted[0].Adds)
+	assert.Equal(t, 0, len(accepted[0].Closes))
+	if assert.Equal(t, 1, len(accepted[0].Links)) {
+		link := accepted[0].Links[0]
+		assert.Equal(t, "0", link.After.ID)
+		assert.Equal(t, "remote P-3", link.After.Message)
+		assert.Equal(t, "P-3", link.After.Links["jira"].ID)
+	}
+}
@@ -0,0 +1,40 @@
+package todo
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// busyTimeout milliseconds sqlite waits for a lock held by another process
+	busyTimeout = 5000
+	// busyRetries times an operation is retried when the lock wait times out
+	busyRetries = 5
+)
+
+// retry f while the database is locked by another process
+func retry(f func() error) error {
+	wait := 50 * time.Millisecond
+	var err error
+	for i := 0; i < busyRetries; i++ {
+		err = f()
+		if !busy(err) {
+			return err
+		}
+		todoLog.Debugf("Database busy, retry in %v", wait)
+		time.Sleep(wait + time.Duration(rand.Int63n(int64(wait))))
+		wait = wait * 2
+	}
+	return errors.Wrap(err, "Database is locked by another todo")
+}
+
+func busy(err error) bool {
+	cause := errors.Cause(err)
+	if e, ok := cause.(sqlite3.Error); ok {
+		return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+	}
+	return false
+}
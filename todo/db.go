@@ -13,12 +13,26 @@ import (
 )
 
 func newSQL(t, p string) (RepoBegin, error) {
-	db, err := sql.Open("sqlite3", p)
+	// wait for other todo processes instead of failing with "database is locked",
+	// and take the write lock when a transaction starts to avoid upgrade deadlocks
+	dsn := "file:" + p + "?_busy_timeout=" + strconv.Itoa(busyTimeout) + "&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, errors.New(err.Error())
 	}
 
+	// write ahead log lets readers continue while another process writes
+	err = retry(func() error {
+		_, err := db.Exec("pragma journal_mode = wal")
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Could not enable write ahead log")
+	}
+
 	_, err = db.Exec(`create table if not exists todo(
+		uuid text,
 		state text, message text,
 		repo text,
 		ext_id text,
@@ -32,9 +46,166 @@ func newSQL(t, p string) (RepoBegin, error) {
 		db.Close()
 		return nil, errors.Wrap(err, "Could not create external index")
 	}
+	err = migrateUUID(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`create table if not exists link(
+		task integer,
+		external text,
+		ext_id text,
+		meta text)`)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Could not create link table")
+	}
+	_, err = db.Exec(`create unique index if not exists link_idx on link(task, external)`)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Could not create link index")
+	}
+	// tasks not yet created in the external have no id
+	_, err = db.Exec(`create unique index if not exists link_external_idx on link(external, ext_id) where ext_id != ''`)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Could not create link external index")
+	}
+	err = migrateLinks(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	_, err = db.Exec(`create table if not exists meta(key text primary key, value text)`)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Could not create meta table")
+	}
 	return &dbRepo{db}, nil
 }
 
+// migrateLinks move the external, <external>.id and <external>.base.* attributes
+// of old databases (or set by hand) to the link table
+func migrateLinks(db *sql.DB) error {
+	rows, err := db.Query(`select rowid, attr from todo where attr like '%"external"%'`)
+	if err != nil {
+		return errors.Wrap(err, "Could not query linked tasks")
+	}
+	attrs := map[int64]map[string]string{}
+	for rows.Next() {
+		var rowid int64
+		var attrB []byte
+		if err := rows.Scan(&rowid, &attrB); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "Could not scan task")
+		}
+		attr, err := decodeAttr(attrB)
+		if err != nil {
+			rows.Close()
+			return errors.Wrap(err, "Could not decode attribute")
+		}
+		if _, ok := attr["external"]; ok {
+			attrs[rowid] = attr
+		}
+	}
+	rows.Close()
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Could not start transaction")
+	}
+	for rowid, attr := range attrs {
+		external := attr["external"]
+		link := Link{ID: attr[external+".id"]}
+		basePrefix := external + ".base."
+		for key, value := range attr {
+			if strings.HasPrefix(key, basePrefix) {
+				link = link.With("base."+strings.TrimPrefix(key, basePrefix), value)
+				delete(attr, key)
+			}
+		}
+		delete(attr, "external")
+		delete(attr, external+".id")
+		todoLog.Debugf("migrate id=%v,link=%s,ext_id=%s", rowid, external, link.ID)
+		attrB, err := encodeAttr(attr)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "Could not encode attributes")
+		}
+		if _, err := tx.Exec("update todo set attr = ?, repo = null, ext_id = null where rowid = ?", attrB, rowid); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "Could not migrate task")
+		}
+		if err := writeLinks(tx, rowid, map[string]Link{external: link}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return errors.Wrap(tx.Commit(), "Could not migrate links")
+}
+
+// migrateUUID add uuid column to old databases and assign uuids to tasks missing one
+func migrateUUID(db *sql.DB) error {
+	rows, err := db.Query("pragma table_info(todo)")
+	if err != nil {
+		return errors.Wrap(err, "Could not read task table")
+	}
+	found := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var def interface{}
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &def, &pk); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "Could not scan task table")
+		}
+		if name == "uuid" {
+			found = true
+		}
+	}
+	rows.Close()
+	if !found {
+		todoLog.Debug("Adding uuid column")
+		if _, err := db.Exec("alter table todo add column uuid text"); err != nil {
+			return errors.Wrap(err, "Could not add uuid column")
+		}
+	}
+
+	rows, err = db.Query("select rowid from todo where uuid is null or uuid = ''")
+	if err != nil {
+		return errors.Wrap(err, "Could not query tasks without uuid")
+	}
+	var missing []int64
+	for rows.Next() {
+		var rowid int64
+		if err := rows.Scan(&rowid); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "Could not scan task")
+		}
+		missing = append(missing, rowid)
+	}
+	rows.Close()
+	for _, rowid := range missing {
+		uuid, err := newUUID()
+		if err != nil {
+			return err
+		}
+		todoLog.Debugf("migrate id=%v,uuid=%s", rowid, uuid)
+		if _, err := db.Exec("update todo set uuid = ? where rowid = ?", uuid, rowid); err != nil {
+			return errors.Wrap(err, "Could not assign uuid")
+		}
+	}
+
+	_, err = db.Exec(`create unique index if not exists uuid_idx on todo(uuid)`)
+	if err != nil {
+		return errors.Wrap(err, "Could not create uuid index")
+	}
+	return nil
+}
+
 func splitPath(path string) (string, string) {
 	t := "sqlite"
 	p := path
@@ -66,7 +237,12 @@ func (d *dbRepo) Close() error {
 }
 
 func (d *dbRepo) Begin() (RepoCommit, error) {
-	tx, err := d.db.Begin()
+	var tx *sql.Tx
+	err := retry(func() error {
+		var err error
+		tx, err = d.db.Begin()
+		return err
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "Could not start transaction")
 	}
@@ -77,22 +253,73 @@ func (d *dbRepo) List() ([]Task, error) {
 	return list(d.db)
 }
 
+func (d *dbRepo) WithAttr(key string) ([]Task, error) {
+	return withAttr(d.db, key)
+}
+
 func (d *dbRepo) Add(message string, attr map[string]string) (Task, error) {
-	return add(d.db, message, attr)
+	var task Task
+	err := d.inTx(func(tx dbOrTx) error {
+		var err error
+		task, err = add(tx, message, attr)
+		return err
+	})
+	return task, err
+}
+
+func (d *dbRepo) Import(task Task) (Task, error) {
+	var imported Task
+	err := d.inTx(func(tx dbOrTx) error {
+		var err error
+		imported, err = importTask(tx, task)
+		return err
+	})
+	return imported, err
 }
 
 func (d *dbRepo) Update(task Task) error {
-	return update(d.db, task)
+	return d.inTx(func(tx dbOrTx) error {
+		return update(tx, task)
+	})
+}
+
+// inTx run f in a transaction, a task and its links are written together
+func (d *dbRepo) inTx(f func(dbOrTx) error) error {
+	return retry(func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := f(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
 }
 
 func (d *dbRepo) Get(id string) (Task, error) {
 	return get(d.db, id)
 }
 
+func (d *dbRepo) GetByUUID(uuid string) (Task, error) {
+	return getByUUID(d.db, uuid)
+}
+
 func (d *dbRepo) GetByExternal(repo, extID string) (Task, error) {
 	return getByExternal(d.db, repo, extID)
 }
 
+func (d *dbRepo) Meta(key string) (string, error) {
+	return getMeta(d.db, key)
+}
+
+func (d *dbRepo) SetMeta(key, value string) error {
+	return d.inTx(func(tx dbOrTx) error {
+		return setMeta(tx, key, value)
+	})
+}
+
 type txRepo struct {
 	tx *sql.Tx
 }
@@ -113,10 +340,18 @@ func (t *txRepo) List() ([]Task, error) {
 	return list(t.tx)
 }
 
+func (t *txRepo) WithAttr(key string) ([]Task, error) {
+	return withAttr(t.tx, key)
+}
+
 func (t *txRepo) Add(message string, attr map[string]string) (Task, error) {
 	return add(t.tx, message, attr)
 }
 
+func (t *txRepo) Import(task Task) (Task, error) {
+	return importTask(t.tx, task)
+}
+
 func (t *txRepo) Update(task Task) error {
 	return update(t.tx, task)
 }
@@ -125,12 +360,69 @@ func (t *txRepo) Get(id string) (Task, error) {
 	return get(t.tx, id)
 }
 
+func (t *txRepo) GetByUUID(uuid string) (Task, error) {
+	return getByUUID(t.tx, uuid)
+}
+
 func (t *txRepo) GetByExternal(repo, extID string) (Task, error) {
 	return getByExternal(t.tx, repo, extID)
 }
 
+func (t *txRepo) Meta(key string) (string, error) {
+	return getMeta(t.tx, key)
+}
+
+func (t *txRepo) SetMeta(key, value string) error {
+	return setMeta(t.tx, key, value)
+}
+
+func getMeta(db dbOrTx, key string) (string, error) {
+	rows, err := db.Query("select value from meta where key = ?", key)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not query meta")
+	}
+	defer rows.Close()
+	var value string
+	if rows.Next() {
+		if err := rows.Scan(&value); err != nil {
+			return "", errors.Wrap(err, "Could not scan meta")
+		}
+	}
+	return value, nil
+}
+
+func setMeta(db dbOrTx, key, value string) error {
+	todoLog.Debugf("meta %s=%s", key, value)
+	_, err := db.Exec("insert or replace into meta(key, value) values (?, ?)", key, value)
+	return errors.Wrap(err, "Could not write meta")
+}
+
 func list(db dbOrTx) ([]Task, error) {
-	rows, err := db.Query("select rowid, state, message, attr from todo where state != 'done'")
+	return query(db, "where state != 'done'")
+}
+
+// withAttr tasks with attribute key, done or not. The attributes are json,
+// like narrows the tasks down and the rest are dropped once decoded.
+func withAttr(db dbOrTx, key string) ([]Task, error) {
+	quoted, err := json.Marshal(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid attribute")
+	}
+	tasks, err := query(db, "where attr like ?", "%"+string(quoted)+":%")
+	if err != nil {
+		return nil, err
+	}
+	var res []Task
+	for _, task := range tasks {
+		if _, ok := task.Attr[key]; ok {
+			res = append(res, task)
+		}
+	}
+	return res, nil
+}
+
+func query(db dbOrTx, where string, args ...interface{}) ([]Task, error) {
+	rows, err := db.Query("select rowid, uuid, state, message, attr from todo "+where, args...)
 	if err != nil {
 		return nil, errors.New(err.Error())
 	}
@@ -138,38 +430,66 @@ func list(db dbOrTx) ([]Task, error) {
 	var message string
 	var state string
 	var rowid int64
+	var uuid string
 	var attrB []byte
 	var tasks []Task
 	for rows.Next() {
-		err = rows.Scan(&rowid, &state, &message, &attrB)
+		err = rows.Scan(&rowid, &uuid, &state, &message, &attrB)
 		if err != nil {
 			return nil, errors.Wrap(err, "Could not scan task")
 		}
-		todoLog.Debugf("list id=%v,state=%s,message=%s,attr=%s", rowid, state, message, string(attrB))
+		todoLog.Debugf("list id=%v,uuid=%s,state=%s,message=%s,attr=%s", rowid, uuid, state, message, string(attrB))
 		attrM, err := decodeAttr(attrB)
 		if err != nil {
 			return nil, errors.Wrap(err, "Could not decode attribute")
 		}
 		tasks = append(tasks, Task{
 			ID:      strconv.FormatInt(rowid, 10),
+			UUID:    uuid,
 			State:   StateFrom(state),
 			Message: message,
 			Attr:    attrM,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Could not list tasks")
+	}
+	rows.Close()
+
+	links, err := readLinks(db, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		tasks[i].Links = links[tasks[i].ID]
+	}
 	return tasks, nil
 }
 
 func add(db dbOrTx, message string, attr map[string]string) (Task, error) {
-	attrB, err := encodeAttr(attr)
+	return importTask(db, Task{
+		State:   StateTodo,
+		Message: message,
+		Attr:    attr,
+	})
+}
+
+// importTask add task keeping its uuid (a new one is generated if missing) and state
+func importTask(db dbOrTx, t Task) (Task, error) {
+	attrB, err := encodeAttr(t.Attr)
 	if err != nil {
 		return Task{}, errors.Wrap(err, "could not encode attr")
 	}
-	repo, extID := getExternal(attr)
-	todoLog.Debugf("add state=%s,message=%s,repo=%s,ext_id=%s,attr=%s",
-		"todo", message, nullable(repo), nullable(extID), string(attrB))
-	r, err := db.Exec("insert into todo(state, message, repo, ext_id, attr) values (?, ?, ?, ?, ?)",
-		"todo", message, repo, extID, attrB)
+	if t.UUID == "" {
+		t.UUID, err = newUUID()
+		if err != nil {
+			return Task{}, err
+		}
+	}
+	todoLog.Debugf("add uuid=%s,state=%s,message=%s,links=%v,attr=%s",
+		t.UUID, t.State.String(), t.Message, t.Links, string(attrB))
+	r, err := db.Exec("insert into todo(uuid, state, message, attr) values (?, ?, ?, ?)",
+		t.UUID, t.State.String(), t.Message, attrB)
 	if err != nil {
 		return Task{}, errors.Wrap(err, "could not write task")
 	}
@@ -177,31 +497,32 @@ func add(db dbOrTx, message string, attr map[string]string) (Task, error) {
 	if err != nil {
 		return Task{}, errors.Wrap(err, "could not get id")
 	}
-	return Task{
-		ID:      strconv.FormatInt(id, 10),
-		State:   "todo",
-		Message: message,
-		Attr:    attr,
-	}, nil
+	if err := writeLinks(db, id, t.Links); err != nil {
+		return Task{}, err
+	}
+	t.ID = strconv.FormatInt(id, 10)
+	return t, nil
 }
 
 func getByRows(rows *sql.Rows) (Task, error) {
 	if rows.Next() {
 		var rowid int64
+		var uuid string
 		var state string
 		var message string
 		var attrB []byte
-		err := rows.Scan(&rowid, &state, &message, &attrB)
+		err := rows.Scan(&rowid, &uuid, &state, &message, &attrB)
 		if err != nil {
 			return Task{}, errors.Wrap(err, "Could not scan row")
 		}
-		todoLog.Debugf("get id=%v,state=%s,message=%s,attr=%s", rowid, state, message, string(attrB))
+		todoLog.Debugf("get id=%v,uuid=%s,state=%s,message=%s,attr=%s", rowid, uuid, state, message, string(attrB))
 		attr, err := decodeAttr(attrB)
 		if err != nil {
 			return Task{}, errors.Wrap(err, "Could not decode attributes")
 		}
 		return Task{
 			ID:      strconv.FormatInt(rowid, 10),
+			UUID:    uuid,
 			State:   StateFrom(state),
 			Message: message,
 			Attr:    attr,
@@ -211,66 +532,155 @@ func getByRows(rows *sql.Rows) (Task, error) {
 }
 
 func get(db dbOrTx, id string) (Task, error) {
-	query := `select rowid, state, message, attr
+	query := `select rowid, uuid, state, message, attr
 	            from todo
 			   where rowid = ?`
 	rows, err := db.Query(query, id)
 	if err != nil {
 		return Task{}, errors.New(err.Error())
 	}
-	defer rows.Close()
-	return getByRows(rows)
+	task, err := getByRows(rows)
+	rows.Close()
+	if err != nil {
+		return task, err
+	}
+	return withLinks(db, task)
 }
 
-func getByExternal(db dbOrTx, repo, extID string) (Task, error) {
-	query := `select rowid, state, message, attr 
-	            from todo 
-	           where repo = ? and ext_id = ?`
-	rows, err := db.Query(query, repo, extID)
+// getByUUID get task by uuid or unique uuid prefix
+func getByUUID(db dbOrTx, uuid string) (Task, error) {
+	uuid = strings.ToLower(uuid)
+	if !uuidPrefix(uuid) {
+		return Task{}, ErrorNotFound
+	}
+	query := `select rowid, uuid, state, message, attr
+	            from todo
+	           where uuid like ?
+	           limit 2`
+	rows, err := db.Query(query, uuid+"%")
 	if err != nil {
 		return Task{}, errors.Wrap(err, "Could not query")
 	}
-	defer rows.Close()
-	return getByRows(rows)
+	task, err := getByRows(rows)
+	if err != nil {
+		rows.Close()
+		return task, err
+	}
+	ambiguous := rows.Next()
+	rows.Close()
+	if ambiguous {
+		return Task{}, ErrorAmbiguous
+	}
+	return withLinks(db, task)
 }
 
-func update(db dbOrTx, t Task) error {
-	attr, err := encodeAttr(t.Attr)
+func getByExternal(db dbOrTx, external, extID string) (Task, error) {
+	query := `select task
+	            from link
+	           where external = ? and ext_id = ?`
+	rows, err := db.Query(query, external, extID)
 	if err != nil {
-		return errors.Wrap(err, "Could not encode attributes")
+		return Task{}, errors.Wrap(err, "Could not query")
 	}
-	repo, extID := getExternal(t.Attr)
-	todoLog.Debugf("update id=%v,state=%s,message=%s,repo=%s,ext_id=%s,attr=%s",
-		t.ID, t.State.String(), t.Message, nullable(repo), nullable(extID), string(attr))
-	r, err := db.Exec("update todo set state = ?, message = ?, repo = ?, ext_id = ?, attr = ? where rowid = ?",
-		t.State.String(), t.Message, repo, extID, attr, t.ID)
+	var rowid int64
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&rowid)
+	}
+	rows.Close()
 	if err != nil {
-		return errors.Wrap(err, "Could not update task")
+		return Task{}, errors.Wrap(err, "Could not scan link")
 	}
-	if rows, _ := r.RowsAffected(); rows != 1 {
-		return errors.New("Update failed, no rows affected")
+	if !found {
+		return Task{}, ErrorNotFound
 	}
-	return nil
+	return get(db, strconv.FormatInt(rowid, 10))
 }
-func getExternal(a map[string]string) (*string, *string) {
-	repo, ok := a["external"]
-	if !ok {
-		return nil, nil
+
+func withLinks(db dbOrTx, task Task) (Task, error) {
+	links, err := readLinks(db, task.ID)
+	if err != nil {
+		return task, err
 	}
-	extID, ok := a[repo+".id"]
-	if !ok {
-		return nil, nil
+	task.Links = links[task.ID]
+	return task, nil
+}
+
+// readLinks read the links of task id, or of all tasks if id is empty
+func readLinks(db dbOrTx, id string) (map[string]map[string]Link, error) {
+	query := "select task, external, ext_id, meta from link"
+	var args []interface{}
+	if id != "" {
+		query += " where task = ?"
+		args = append(args, id)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not query links")
 	}
-	return &repo, &extID
+	defer rows.Close()
+	res := map[string]map[string]Link{}
+	for rows.Next() {
+		var task int64
+		var external, extID string
+		var metaB []byte
+		if err := rows.Scan(&task, &external, &extID, &metaB); err != nil {
+			return nil, errors.Wrap(err, "Could not scan link")
+		}
+		link := Link{ID: extID}
+		if len(metaB) != 0 {
+			if err := json.Unmarshal(metaB, &link.Meta); err != nil {
+				return nil, errors.Wrap(err, "Could not decode link")
+			}
+		}
+		key := strconv.FormatInt(task, 10)
+		if res[key] == nil {
+			res[key] = map[string]Link{}
+		}
+		res[key][external] = link
+	}
+	return res, rows.Err()
 }
 
-func nullable(s *string) string {
-	if s == nil {
-		return "<nil>"
+// writeLinks replace the links of task rowid
+func writeLinks(db dbOrTx, rowid interface{}, links map[string]Link) error {
+	if _, err := db.Exec("delete from link where task = ?", rowid); err != nil {
+		return errors.Wrap(err, "Could not remove links")
 	}
-	return *s
+	for external, link := range links {
+		var metaB []byte
+		if len(link.Meta) != 0 {
+			var err error
+			if metaB, err = json.Marshal(link.Meta); err != nil {
+				return errors.Wrap(err, "Could not encode link")
+			}
+		}
+		_, err := db.Exec("insert into link(task, external, ext_id, meta) values (?, ?, ?, ?)",
+			rowid, external, link.ID, metaB)
+		if err != nil {
+			return errors.Wrapf(err, "Could not link to %s %s", external, link.ID)
+		}
+	}
+	return nil
 }
 
+func update(db dbOrTx, t Task) error {
+	attr, err := encodeAttr(t.Attr)
+	if err != nil {
+		return errors.Wrap(err, "Could not encode attributes")
+	}
+	todoLog.Debugf("update id=%v,state=%s,message=%s,links=%v,attr=%s",
+		t.ID, t.State.String(), t.Message, t.Links, string(attr))
+	r, err := db.Exec("update todo set state = ?, message = ?, repo = null, ext_id = null, attr = ? where rowid = ?",
+		t.State.String(), t.Message, attr, t.ID)
+	if err != nil {
+		return errors.Wrap(err, "Could not update task")
+	}
+	if rows, _ := r.RowsAffected(); rows != 1 {
+		return errors.New("Update failed, no rows affected")
+	}
+	return writeLinks(db, t.ID, t.Links)
+}
 func encodeAttr(a map[string]string) ([]byte, error) {
 	if a == nil || len(a) == 0 {
 		return nil, nil
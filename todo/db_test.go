@@ -0,0 +1,57 @@
+package todo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempRepo(t *testing.T) (RepoBegin, func()) {
+	dir, err := ioutil.TempDir("", "todo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := RepoFromPath(filepath.Join(dir, "todo.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return r, func() {
+		r.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestWithAttr(t *testing.T) {
+	r, done := tempRepo(t)
+	defer done()
+
+	r.Add("plain", nil)
+	r.Add("quoted", map[string]string{"note": `"outbox": in a note`})
+	open, _ := r.Add("open", map[string]string{"outbox": "unreachable"})
+	closed, _ := r.Add("closed", map[string]string{"outbox": "unreachable"})
+	closed.State = StateDone
+	if !assert.Nil(t, r.Update(closed)) {
+		return
+	}
+
+	ts, err := r.WithAttr("outbox")
+	if !assert.Nil(t, err) || !assert.Equal(t, 2, len(ts)) {
+		return
+	}
+	assert.Equal(t, open.ID, ts[0].ID)
+	assert.Equal(t, closed.ID, ts[1].ID)
+	assert.Equal(t, StateDone, ts[1].State)
+
+	listed, _ := r.List()
+	assert.Equal(t, 3, len(listed), "list leaves out done tasks")
+
+	tx, _ := r.Begin()
+	defer tx.Close()
+	ts, err = tx.WithAttr("outbox")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ts))
+}
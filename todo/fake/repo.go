@@ -3,6 +3,7 @@ package fake
 import (
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/jwiklund/todo/todo"
 )
@@ -15,6 +16,7 @@ func New() *Fake {
 // Fake a fake repo
 type Fake struct {
 	todos []todo.Task
+	meta  map[string]string
 }
 
 // Close noop
@@ -37,6 +39,17 @@ func (r *Fake) List() ([]todo.Task, error) {
 	return r.todos, nil
 }
 
+// WithAttr return todos with attribute key
+func (r *Fake) WithAttr(key string) ([]todo.Task, error) {
+	var res []todo.Task
+	for _, t := range r.todos {
+		if _, ok := t.Attr[key]; ok {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
 // MustList return todos
 func (r *Fake) MustList() []todo.Task {
 	return r.todos
@@ -52,13 +65,28 @@ func (r *Fake) Get(id string) (todo.Task, error) {
 	return todo.Task{}, errors.New("not found")
 }
 
+// GetByUUID return task by uuid prefix
+func (r *Fake) GetByUUID(uuid string) (todo.Task, error) {
+	var found []todo.Task
+	for _, t := range r.todos {
+		if t.UUID != "" && strings.HasPrefix(t.UUID, uuid) {
+			found = append(found, t)
+		}
+	}
+	if len(found) > 1 {
+		return todo.Task{}, todo.ErrorAmbiguous
+	}
+	if len(found) == 0 {
+		return todo.Task{}, todo.ErrorNotFound
+	}
+	return found[0], nil
+}
+
 // GetByExternal return task by external id
 func (r *Fake) GetByExternal(repo, extID string) (todo.Task, error) {
 	for _, t := range r.todos {
-		if ex, ok := t.Attr["external"]; ok && ex == repo {
-			if eid, ok := t.Attr[ex+".id"]; ok && extID == eid {
-				return t, nil
-			}
+		if l, ok := t.Link(repo); ok && l.ID == extID {
+			return t, nil
 		}
 	}
 	return todo.Task{}, todo.ErrorNotFound
@@ -86,6 +114,13 @@ func (r *Fake) Add(message string, attr map[string]string) (todo.Task, error) {
 	return task, nil
 }
 
+// Import create task keeping uuid and state
+func (r *Fake) Import(task todo.Task) (todo.Task, error) {
+	task.ID = strconv.Itoa(len(r.todos))
+	r.todos = append(r.todos, task)
+	return task, nil
+}
+
 // MustAdd create task
 func (r *Fake) MustAdd(message string, attr map[string]string) todo.Task {
 	t, _ := r.Add(message, attr)
@@ -103,6 +138,20 @@ func (r *Fake) Update(newTask todo.Task) error {
 	return errors.New("task not found")
 }
 
+// Meta return metadata
+func (r *Fake) Meta(key string) (string, error) {
+	return r.meta[key], nil
+}
+
+// SetMeta set metadata
+func (r *Fake) SetMeta(key, value string) error {
+	if r.meta == nil {
+		r.meta = map[string]string{}
+	}
+	r.meta[key] = value
+	return nil
+}
+
 // MustUpdate update task
 func (r *Fake) MustUpdate(newTask todo.Task) {
 	err := r.Update(newTask)
@@ -0,0 +1,104 @@
+package todo
+
+import "sort"
+
+// Link a task mirrored in an external
+type Link struct {
+	// ID of the task in the external, empty until the external assigned one
+	ID string
+	// Meta sync metadata, such as the task as it was at last sync
+	Meta map[string]string `json:",omitempty"`
+}
+
+// metaDetached set on links of tasks detached from the external
+const metaDetached = "detached"
+
+// Detached true if the task was detached from the external and is kept local.
+// The link is kept so that sync does not import the external task again.
+func (l Link) Detached() bool {
+	return l.Meta[metaDetached] == "true"
+}
+
+// Detach return a copy of the link marked as detached
+func (l Link) Detach() Link {
+	return l.With(metaDetached, "true")
+}
+
+// Attach return a copy of the link no longer detached
+func (l Link) Attach() Link {
+	if !l.Detached() {
+		return l
+	}
+	meta := map[string]string{}
+	for k, v := range l.Meta {
+		if k != metaDetached {
+			meta[k] = v
+		}
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+	l.Meta = meta
+	return l
+}
+
+// With return a copy of the link with meta key set to value
+func (l Link) With(key, value string) Link {
+	meta := map[string]string{}
+	for k, v := range l.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	l.Meta = meta
+	return l
+}
+
+// Link get the link to external, if linked
+func (t Task) Link(external string) (Link, bool) {
+	l, ok := t.Links[external]
+	return l, ok
+}
+
+// Attached true if the task is linked to external and not detached from it
+func (t Task) Attached(external string) bool {
+	l, ok := t.Links[external]
+	return ok && !l.Detached()
+}
+
+// Linked names of the externals the task is linked to, sorted
+func (t Task) Linked() []string {
+	var names []string
+	for name := range t.Links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetLink link the task to external, the links are copied so that copies of
+// the task are not changed
+func (t *Task) SetLink(external string, l Link) {
+	links := map[string]Link{}
+	for name, link := range t.Links {
+		links[name] = link
+	}
+	links[external] = l
+	t.Links = links
+}
+
+// Unlink remove the link to external
+func (t *Task) Unlink(external string) {
+	if _, ok := t.Links[external]; !ok {
+		return
+	}
+	links := map[string]Link{}
+	for name, link := range t.Links {
+		if name != external {
+			links[name] = link
+		}
+	}
+	if len(links) == 0 {
+		links = nil
+	}
+	t.Links = links
+}
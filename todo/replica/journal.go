@@ -0,0 +1,327 @@
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldMessage = "message"
+	fieldState   = "state"
+	attrPrefix   = "attr:"
+	linkPrefix   = "link:"
+)
+
+// entry a single field mutation written by one device
+type entry struct {
+	UUID    string `json:"uuid"`
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Time    int64  `json:"time"`
+	Device  string `json:"device"`
+	// Base version of the value this entry overwrote, as known by the writer
+	Base string `json:"base,omitempty"`
+}
+
+func (e entry) version() string {
+	return fmt.Sprintf("%s@%d", e.Device, e.Time)
+}
+
+// newer deterministic last writer wins, ties broken by device name
+func (e entry) newer(o entry) bool {
+	if e.Time != o.Time {
+		return e.Time > o.Time
+	}
+	return e.Device > o.Device
+}
+
+type fieldKey struct {
+	uuid  string
+	field string
+}
+
+// conflict concurrent writes to the same field from different devices
+type conflict struct {
+	key     fieldKey
+	entries []entry
+	winner  entry
+}
+
+func (c conflict) String() string {
+	var values []string
+	for _, e := range c.entries {
+		values = append(values, fmt.Sprintf("%s=%q", e.version(), value(e)))
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", c.key.uuid, c.key.field, strings.Join(values, " "), c.winner.Device)
+}
+
+func value(e entry) string {
+	if e.Deleted {
+		return "<deleted>"
+	}
+	return e.Value
+}
+
+type journal struct {
+	dir     string
+	device  string
+	winners map[fieldKey]entry
+	last    int64
+}
+
+func newJournal(dir, device string) *journal {
+	return &journal{dir, device, map[fieldKey]entry{}, 0}
+}
+
+func (j *journal) path(device string) string {
+	return filepath.Join(j.dir, device+".journal")
+}
+
+func (j *journal) conflictPath() string {
+	return filepath.Join(j.dir, j.device+".conflicts")
+}
+
+// record create an entry for a local change, not visible until appended
+func (j *journal) record(uuid, field, value string, deleted bool) entry {
+	now := time.Now().UnixNano()
+	if now <= j.last {
+		now = j.last + 1
+	}
+	e := entry{
+		UUID:    uuid,
+		Field:   field,
+		Value:   value,
+		Deleted: deleted,
+		Device:  j.device,
+	}
+	if base, ok := j.winners[fieldKey{uuid, field}]; ok {
+		e.Base = base.version()
+		// a change is always newer than what it replaces, even with skewed clocks
+		if now <= base.Time {
+			now = base.Time + 1
+		}
+	}
+	e.Time = now
+	j.last = now
+	return e
+}
+
+// changes return entries for all fields that differ between original and modified
+func (j *journal) changes(original, modified todo.Task) []entry {
+	var es []entry
+	uuid := original.UUID
+	if uuid == "" {
+		uuid = modified.UUID
+	}
+	if uuid == "" {
+		replicaLog.Debugf("Task %s has no uuid, not replicated", modified.ID)
+		return nil
+	}
+	if original.Message != modified.Message {
+		es = append(es, j.record(uuid, fieldMessage, modified.Message, false))
+	}
+	if original.State != modified.State {
+		es = append(es, j.record(uuid, fieldState, modified.State.String(), false))
+	}
+	for _, key := range sortedKeys(modified.Attr) {
+		if old, ok := original.Attr[key]; !ok || old != modified.Attr[key] {
+			es = append(es, j.record(uuid, attrPrefix+key, modified.Attr[key], false))
+		}
+	}
+	for _, key := range sortedKeys(original.Attr) {
+		if _, ok := modified.Attr[key]; !ok {
+			es = append(es, j.record(uuid, attrPrefix+key, "", true))
+		}
+	}
+	for _, name := range modified.Linked() {
+		link, _ := modified.Link(name)
+		if old, ok := original.Link(name); !ok || !reflect.DeepEqual(old, link) {
+			es = append(es, j.record(uuid, linkPrefix+name, encodeLink(link), false))
+		}
+	}
+	for _, name := range original.Linked() {
+		if _, ok := modified.Link(name); !ok {
+			es = append(es, j.record(uuid, linkPrefix+name, "", true))
+		}
+	}
+	return es
+}
+
+func encodeLink(l todo.Link) string {
+	bs, _ := json.Marshal(l)
+	return string(bs)
+}
+
+func decodeLink(s string) (todo.Link, error) {
+	var l todo.Link
+	err := json.Unmarshal([]byte(s), &l)
+	return l, err
+}
+
+// append write entries to the journal of this device
+func (j *journal) append(es []entry) error {
+	if len(es) == 0 {
+		return nil
+	}
+	buf := bytes.Buffer{}
+	for _, e := range es {
+		bs, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, "Could not encode journal entry")
+		}
+		buf.Write(bs)
+		buf.WriteByte('\n')
+	}
+	f, err := os.OpenFile(j.path(j.device), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		return errors.Wrap(err, "Could not open journal")
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Could not write journal")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "Could not write journal")
+	}
+	for _, e := range es {
+		j.apply(e)
+	}
+	return nil
+}
+
+func (j *journal) apply(e entry) {
+	key := fieldKey{e.UUID, e.Field}
+	if w, ok := j.winners[key]; !ok || e.newer(w) {
+		j.winners[key] = e
+	}
+}
+
+// read all entries from all device journals in the shared directory
+func (j *journal) read() ([]entry, error) {
+	files, err := filepath.Glob(filepath.Join(j.dir, "*.journal"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list journals")
+	}
+	sort.Strings(files)
+	var es []entry
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not open journal")
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var e entry
+			if err := json.Unmarshal(line, &e); err != nil {
+				// most likely a partially synced line, picked up next time
+				replicaLog.Debugf("Ignoring invalid journal line in %s: %v", file, err)
+				continue
+			}
+			if e.Time > j.last {
+				j.last = e.Time
+			}
+			es = append(es, e)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read journal "+file)
+		}
+	}
+	return es, nil
+}
+
+// conflicts find entries from different devices that overwrote the same version
+func conflicts(es []entry) []conflict {
+	type baseKey struct {
+		key  fieldKey
+		base string
+	}
+	groups := map[baseKey][]entry{}
+	for _, e := range es {
+		k := baseKey{fieldKey{e.UUID, e.Field}, e.Base}
+		groups[k] = append(groups[k], e)
+	}
+	var res []conflict
+	for k, group := range groups {
+		devices := map[string]entry{}
+		for _, e := range group {
+			if d, ok := devices[e.Device]; !ok || e.newer(d) {
+				devices[e.Device] = e
+			}
+		}
+		if len(devices) < 2 {
+			continue
+		}
+		var latest []entry
+		values := map[string]bool{}
+		for _, e := range devices {
+			latest = append(latest, e)
+			values[value(e)] = true
+		}
+		if len(values) < 2 {
+			// same value written on several devices, nothing lost
+			continue
+		}
+		sort.Slice(latest, func(i, j int) bool { return latest[j].newer(latest[i]) })
+		res = append(res, conflict{k.key, latest, latest[len(latest)-1]})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].key.uuid != res[j].key.uuid {
+			return res[i].key.uuid < res[j].key.uuid
+		}
+		return res[i].key.field < res[j].key.field
+	})
+	return res
+}
+
+// writeConflicts rewrite the conflict log, return true if it changed
+func (j *journal) writeConflicts(cs []conflict) (bool, error) {
+	buf := bytes.Buffer{}
+	for _, c := range cs {
+		buf.WriteString(c.String())
+		buf.WriteByte('\n')
+	}
+	old, err := ioutil.ReadFile(j.conflictPath())
+	if err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "Could not read conflict log")
+	}
+	if bytes.Equal(old, buf.Bytes()) {
+		return false, nil
+	}
+	if len(cs) == 0 {
+		return true, os.Remove(j.conflictPath())
+	}
+	if err := util.WriteFile(j.conflictPath(), buf.Bytes(), 0660); err != nil {
+		return false, errors.Wrap(err, "Could not write conflict log")
+	}
+	return true, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
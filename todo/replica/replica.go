@@ -0,0 +1,332 @@
+package replica
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+var replicaLog = logrus.WithField("comp", "replica")
+
+// New wrap repo so that all changes are appended to the journal of device in
+// dir, and changes from other devices journals are merged into repo.
+func New(repo todo.RepoBegin, dir, device string) (todo.RepoBegin, error) {
+	if device == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not get hostname, set device in config")
+		}
+		device = host
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Replica directory not found")
+	}
+	if !stat.IsDir() {
+		return nil, errors.New("Replica is not a directory " + dir)
+	}
+	j := newJournal(dir, device)
+	r := &replicaRepo{base{repo, j, nil}, repo}
+	if err := r.merge(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// base journal all changes made through r, by emit
+type base struct {
+	r    todo.Repo
+	j    *journal
+	emit func([]entry) error
+}
+
+func (b *base) List() ([]todo.Task, error) {
+	return b.r.List()
+}
+
+func (b *base) WithAttr(key string) ([]todo.Task, error) {
+	return b.r.WithAttr(key)
+}
+
+func (b *base) Get(id string) (todo.Task, error) {
+	return b.r.Get(id)
+}
+
+func (b *base) GetByUUID(uuid string) (todo.Task, error) {
+	return b.r.GetByUUID(uuid)
+}
+
+func (b *base) GetByExternal(repo, extID string) (todo.Task, error) {
+	return b.r.GetByExternal(repo, extID)
+}
+
+// Meta is not replicated, each device syncs its externals itself
+func (b *base) Meta(key string) (string, error) {
+	return b.r.Meta(key)
+}
+
+func (b *base) SetMeta(key, value string) error {
+	return b.r.SetMeta(key, value)
+}
+
+func (b *base) Add(message string, attr map[string]string) (todo.Task, error) {
+	task, err := b.r.Add(message, attr)
+	if err != nil {
+		return task, err
+	}
+	return task, b.emit(b.j.changes(todo.Task{}, task))
+}
+
+func (b *base) Import(task todo.Task) (todo.Task, error) {
+	task, err := b.r.Import(task)
+	if err != nil {
+		return task, err
+	}
+	return task, b.emit(b.j.changes(todo.Task{}, task))
+}
+
+func (b *base) Update(task todo.Task) error {
+	original, err := b.r.Get(task.ID)
+	if err != nil {
+		return err
+	}
+	if err := b.r.Update(task); err != nil {
+		return err
+	}
+	return b.emit(b.j.changes(original, task))
+}
+
+// replicaRepo make each change in a transaction, journaled before it is
+// committed
+type replicaRepo struct {
+	base
+	repo todo.RepoBegin
+}
+
+func (r *replicaRepo) inTx(f func(todo.Repo) error) error {
+	tx, err := r.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Close()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *replicaRepo) Add(message string, attr map[string]string) (todo.Task, error) {
+	var task todo.Task
+	err := r.inTx(func(tx todo.Repo) error {
+		var err error
+		task, err = tx.Add(message, attr)
+		return err
+	})
+	return task, err
+}
+
+func (r *replicaRepo) Import(task todo.Task) (todo.Task, error) {
+	err := r.inTx(func(tx todo.Repo) error {
+		var err error
+		task, err = tx.Import(task)
+		return err
+	})
+	return task, err
+}
+
+func (r *replicaRepo) Update(task todo.Task) error {
+	return r.inTx(func(tx todo.Repo) error {
+		return tx.Update(task)
+	})
+}
+
+func (r *replicaRepo) Begin() (todo.RepoCommit, error) {
+	c, err := r.repo.Begin()
+	if err != nil {
+		return nil, err
+	}
+	tx := &replicaTx{base{c, r.j, nil}, c, nil}
+	tx.emit = func(es []entry) error {
+		tx.pending = append(tx.pending, es...)
+		return nil
+	}
+	return tx, nil
+}
+
+func (r *replicaRepo) Close() error {
+	return r.repo.Close()
+}
+
+type replicaTx struct {
+	base
+	tx      todo.RepoCommit
+	pending []entry
+}
+
+// Commit journal the changes first, a change is never committed without
+// being replicated. One journaled but not committed is merged on next open.
+func (t *replicaTx) Commit() error {
+	pending := t.pending
+	t.pending = nil
+	if err := t.j.append(pending); err != nil {
+		t.tx.Close()
+		return err
+	}
+	return t.tx.Commit()
+}
+
+func (t *replicaTx) Close() error {
+	t.pending = nil
+	return t.tx.Close()
+}
+
+// merge apply the winning value of every field in all journals to the local
+// repo, then journal local tasks not known by any device.
+func (r *replicaRepo) merge() error {
+	es, err := r.j.read()
+	if err != nil {
+		return err
+	}
+	for _, e := range es {
+		r.j.apply(e)
+	}
+
+	byUUID := map[string][]entry{}
+	for _, w := range r.j.winners {
+		byUUID[w.UUID] = append(byUUID[w.UUID], w)
+	}
+	var uuids []string
+	for uuid := range byUUID {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	tx, err := r.repo.Begin()
+	if err != nil {
+		return err
+	}
+	for _, uuid := range uuids {
+		if err := mergeTask(tx, uuid, byUUID[uuid]); err != nil {
+			tx.Close()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := r.bootstrap(); err != nil {
+		return err
+	}
+
+	cs := conflicts(es)
+	changed, err := r.j.writeConflicts(cs)
+	if err != nil {
+		return err
+	}
+	if changed && len(cs) != 0 {
+		replicaLog.Warnf("%d concurrent edits resolved by last writer, see %s", len(cs), r.j.conflictPath())
+	}
+	return nil
+}
+
+func mergeTask(r todo.Repo, uuid string, winners []entry) error {
+	local, err := r.GetByUUID(uuid)
+	exists := true
+	if err == todo.ErrorNotFound {
+		exists = false
+		local = todo.Task{UUID: uuid, State: todo.StateTodo}
+	} else if err != nil {
+		return err
+	}
+	merged := local
+	merged.Attr = map[string]string{}
+	for key, value := range local.Attr {
+		merged.Attr[key] = value
+	}
+	for _, w := range winners {
+		switch {
+		case w.Field == fieldMessage:
+			merged.Message = w.Value
+		case w.Field == fieldState:
+			merged.State = todo.StateFrom(w.Value)
+		case strings.HasPrefix(w.Field, attrPrefix):
+			key := strings.TrimPrefix(w.Field, attrPrefix)
+			if w.Deleted {
+				delete(merged.Attr, key)
+			} else {
+				merged.Attr[key] = w.Value
+			}
+		case strings.HasPrefix(w.Field, linkPrefix):
+			name := strings.TrimPrefix(w.Field, linkPrefix)
+			if w.Deleted {
+				merged.Unlink(name)
+				continue
+			}
+			link, err := decodeLink(w.Value)
+			if err != nil {
+				replicaLog.Debugf("Invalid link %s for %s: %v", w.Value, uuid, err)
+				continue
+			}
+			merged.SetLink(name, link)
+		default:
+			replicaLog.Debugf("Unknown field %s for %s", w.Field, uuid)
+		}
+	}
+	if !exists {
+		replicaLog.Debugf("merge add %s %s", uuid, merged.Message)
+		if _, err := r.Import(merged); err != nil {
+			// typically an external id already linked to another task
+			replicaLog.Warnf("Could not merge task %s %s: %v", uuid, merged.Message, err)
+		}
+		return nil
+	}
+	if len(local.Attr) == 0 && len(merged.Attr) == 0 {
+		merged.Attr = local.Attr
+	}
+	if !local.Equal(merged) {
+		replicaLog.Debugf("merge update %s %s", uuid, merged.Message)
+		return r.Update(merged)
+	}
+	return nil
+}
+
+// bootstrap journal fields of local tasks that no device has written yet
+func (r *replicaRepo) bootstrap() error {
+	tasks, err := r.repo.List()
+	if err != nil {
+		return err
+	}
+	var es []entry
+	for _, task := range tasks {
+		if task.UUID == "" {
+			continue
+		}
+		known := todo.Task{UUID: task.UUID, Attr: map[string]string{}}
+		if _, ok := r.j.winners[fieldKey{task.UUID, fieldMessage}]; ok {
+			known.Message = task.Message
+		}
+		if _, ok := r.j.winners[fieldKey{task.UUID, fieldState}]; ok {
+			known.State = task.State
+		}
+		for key, value := range task.Attr {
+			if _, ok := r.j.winners[fieldKey{task.UUID, attrPrefix + key}]; ok {
+				known.Attr[key] = value
+			}
+		}
+		for name, link := range task.Links {
+			if _, ok := r.j.winners[fieldKey{task.UUID, linkPrefix + name}]; ok {
+				known.SetLink(name, link)
+			}
+		}
+		es = append(es, r.j.changes(known, task)...)
+	}
+	if len(es) != 0 {
+		replicaLog.Debugf("Journal %d existing fields", len(es))
+	}
+	return r.j.append(es)
+}
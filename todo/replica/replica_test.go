@@ -0,0 +1,147 @@
+package replica
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReplicateImport(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := New(fake.New(), dir, "a")
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = a.Import(todo.Task{
+		UUID:    "u1",
+		State:   todo.StateDoing,
+		Message: "message",
+		Attr:    map[string]string{"prio": "1"},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	r := fake.New()
+	if _, err := New(r, dir, "b"); !assert.Nil(t, err) {
+		return
+	}
+	if assert.Equal(t, 1, len(r.MustList())) {
+		task := r.MustList()[0]
+		assert.Equal(t, "u1", task.UUID)
+		assert.Equal(t, "message", task.Message)
+		assert.Equal(t, todo.StateDoing, task.State)
+		assert.Equal(t, map[string]string{"prio": "1"}, task.Attr)
+	}
+}
+
+func TestReplicateUpdateInTransaction(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ra := fake.New()
+	ra.Import(todo.Task{UUID: "u1", State: todo.StateTodo, Message: "message"})
+	a, _ := New(ra, dir, "a")
+	rb := fake.New()
+	New(rb, dir, "b")
+
+	tx, _ := a.Begin()
+	task := ra.MustGet("0")
+	task.State = todo.StateDone
+	if !assert.Nil(t, tx.Update(task)) || !assert.Nil(t, tx.Commit()) {
+		return
+	}
+
+	New(rb, dir, "b")
+	assert.Equal(t, todo.StateDone, rb.MustGet("0").State)
+}
+
+func TestConcurrentEditLastWriterWins(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ra := fake.New()
+	ra.Import(todo.Task{UUID: "u1", State: todo.StateTodo, Message: "message"})
+	a, _ := New(ra, dir, "a")
+	rb := fake.New()
+	b, _ := New(rb, dir, "b")
+
+	ta := ra.MustGet("0")
+	ta.Message = "first"
+	a.Update(ta)
+	tb := rb.MustGet("0")
+	tb.Message = "second"
+	b.Update(tb)
+
+	New(ra, dir, "a")
+	New(rb, dir, "b")
+	assert.Equal(t, "second", ra.MustGet("0").Message)
+	assert.Equal(t, "second", rb.MustGet("0").Message)
+
+	log, err := ioutil.ReadFile(filepath.Join(dir, "a.conflicts"))
+	if assert.Nil(t, err) {
+		assert.Contains(t, string(log), "u1 message")
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	es := []entry{
+		{UUID: "u", Field: "message", Value: "a", Time: 2, Device: "a", Base: "c@1"},
+		{UUID: "u", Field: "message", Value: "b", Time: 3, Device: "b", Base: "c@1"},
+		{UUID: "u", Field: "state", Value: "done", Time: 3, Device: "b", Base: "c@1"},
+		{UUID: "u", Field: "state", Value: "done", Time: 4, Device: "a", Base: "c@1"},
+	}
+	cs := conflicts(es)
+	if assert.Equal(t, 1, len(cs)) {
+		assert.Equal(t, "message", cs[0].key.field)
+		assert.Equal(t, "b", cs[0].winner.Device)
+	}
+}
+
+func TestJournalFailsUpdate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	r, err := todo.RepoFromPath(filepath.Join(dir, "todo.db"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer r.Close()
+	shared := filepath.Join(dir, "shared")
+	os.Mkdir(shared, 0770)
+	a, err := New(r, shared, "a")
+	if !assert.Nil(t, err) {
+		return
+	}
+	task, err := a.Import(todo.Task{UUID: "u1", State: todo.StateTodo, Message: "message"})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// the replica directory is unavailable
+	os.RemoveAll(shared)
+	task.Message = "changed"
+	assert.NotNil(t, a.Update(task))
+	_, err = a.Add("added", nil)
+	assert.NotNil(t, err)
+
+	ts, _ := r.List()
+	if assert.Equal(t, 1, len(ts)) {
+		assert.Equal(t, "message", ts[0].Message, "not committed unless journaled")
+	}
+}
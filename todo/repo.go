@@ -9,15 +9,24 @@ var (
 	todoLog = logrus.WithField("comp", "todo")
 	// ErrorNotFound error returned when task was not found.
 	ErrorNotFound = errors.New("Task not found")
+	// ErrorAmbiguous error returned when a uuid prefix matches several tasks.
+	ErrorAmbiguous = errors.New("Task uuid is ambiguous")
 )
 
 // Repo a todo repository
 type Repo interface {
 	List() ([]Task, error)
+	// WithAttr tasks with attribute key, done tasks included
+	WithAttr(key string) ([]Task, error)
 	Add(string, map[string]string) (Task, error)
 	Get(string) (Task, error)
+	GetByUUID(string) (Task, error)
 	GetByExternal(remoteID, externalID string) (Task, error)
 	Update(Task) error
+	Import(Task) (Task, error)
+	// Meta get repo metadata, such as the last sync of an external, empty if not set
+	Meta(key string) (string, error)
+	SetMeta(key, value string) error
 
 	Close() error
 }
@@ -44,3 +53,10 @@ func RepoFromPath(path string) (RepoBegin, error) {
 
 	return newSQL("sqlite3", p)
 }
+
+// LockPath return the advisory lock file used for long operations on the
+// repository stored in path
+func LockPath(path string) string {
+	_, p := splitPath(path)
+	return p + ".lock"
+}
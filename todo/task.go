@@ -8,9 +8,12 @@ import (
 // Task a todo task
 type Task struct {
 	ID      string
+	UUID    string
 	State   State
 	Message string
 	Attr    map[string]string
+	// Links to externals by external name
+	Links map[string]Link `json:",omitempty"`
 }
 
 func (t Task) String() string {
@@ -27,27 +30,6 @@ func (t Task) IsCurrent() bool {
 	return t.State == "todo" || t.State == "doing"
 }
 
-// External get external repo identifier, if present (else "")
-func (t Task) External() string {
-	ext, _ := t.Attr["external"]
-	return ext
-}
-
-// ExternalID get id in external repo, if present (else "")
-func (t Task) ExternalID() string {
-	ext := t.External()
-	extID, _ := t.Attr[ext+".id"]
-	return extID
-}
-
-// SetExternalID set external id if external is present
-func (t Task) SetExternalID(externalID string) {
-	if t.External() == "" {
-		return
-	}
-	t.Attr[t.External()+".id"] = externalID
-}
-
 // Prio get the prio of this task
 func (t Task) Prio() int {
 	prio, _ := t.Attr["prio"]
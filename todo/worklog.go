@@ -0,0 +1,114 @@
+package todo
+
+import (
+	"strings"
+	"time"
+)
+
+// Worklog attribute of the intervals worked on a task, one per line as
+// "<start> <end>" in RFC3339, the end is missing while working on it
+const Worklog = "worklog"
+
+// Interval a period worked on a task, End is zero while working
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Done true if the interval has ended
+func (i Interval) Done() bool {
+	return !i.End.IsZero()
+}
+
+// Duration of the interval, until now if not done
+func (i Interval) Duration() time.Duration {
+	if !i.Done() {
+		return time.Since(i.Start)
+	}
+	return i.End.Sub(i.Start)
+}
+
+// Key identifies the interval, the start
+func (i Interval) Key() string {
+	return i.Start.UTC().Format(time.RFC3339)
+}
+
+func (i Interval) String() string {
+	if !i.Done() {
+		return i.Key()
+	}
+	return i.Key() + " " + i.End.UTC().Format(time.RFC3339)
+}
+
+// Worklog the intervals worked on the task, oldest first. Invalid lines are
+// skipped.
+func (t Task) Worklog() []Interval {
+	var res []Interval
+	for _, line := range strings.Split(t.Attr[Worklog], "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		var i Interval
+		var err error
+		if i.Start, err = time.Parse(time.RFC3339, parts[0]); err != nil {
+			todoLog.Debugf("Invalid worklog %s of %s", line, t.ID)
+			continue
+		}
+		if len(parts) > 1 {
+			if i.End, err = time.Parse(time.RFC3339, parts[1]); err != nil {
+				todoLog.Debugf("Invalid worklog %s of %s", line, t.ID)
+				continue
+			}
+		}
+		res = append(res, i)
+	}
+	return res
+}
+
+func (t *Task) setWorklog(intervals []Interval) {
+	var lines []string
+	for _, i := range intervals {
+		lines = append(lines, i.String())
+	}
+	attr := map[string]string{}
+	for key, value := range t.Attr {
+		attr[key] = value
+	}
+	attr[Worklog] = strings.Join(lines, "\n")
+	t.Attr = attr
+}
+
+// StartWork start an interval at now, unless one is running
+func (t *Task) StartWork(now time.Time) {
+	intervals := t.Worklog()
+	if len(intervals) > 0 && !intervals[len(intervals)-1].Done() {
+		return
+	}
+	t.setWorklog(append(intervals, Interval{Start: now}))
+}
+
+// StopWork end the running interval at now, if any
+func (t *Task) StopWork(now time.Time) {
+	intervals := t.Worklog()
+	if len(intervals) == 0 || intervals[len(intervals)-1].Done() {
+		return
+	}
+	intervals[len(intervals)-1].End = now
+	t.setWorklog(intervals)
+}
+
+// metaWorklog link meta of the intervals logged in the external,
+// worklog.<start> holds the id the external gave the log
+const metaWorklog = "worklog."
+
+// Logged true if interval i was logged in the external
+func (l Link) Logged(i Interval) bool {
+	_, ok := l.Meta[metaWorklog+i.Key()]
+	return ok
+}
+
+// Log return a copy of the link with interval i logged as id
+func (l Link) Log(i Interval, id string) Link {
+	return l.With(metaWorklog+i.Key(), id)
+}
@@ -50,6 +50,39 @@ func TestToml(t *testing.T) {
 	assert.Equal(t, "repo", c.Repo)
 }
 
+func TestTomlReplica(t *testing.T) {
+	c, e := readConfigToml(strings.NewReader(`
+	replica = "~/Dropbox/todo"
+	device = "laptop"
+	`))
+	if !assert.Nil(t, e) {
+		return
+	}
+	assert.Equal(t, "~/Dropbox/todo", c.Replica)
+	assert.Equal(t, "laptop", c.Device)
+	assert.Equal(t, 0, len(c.External))
+}
+
+func TestTomlRepos(t *testing.T) {
+	c, e := readConfigToml(strings.NewReader(`
+	repo = "sqlite://~/.todo.db"
+
+	[repos]
+	work = "sqlite://~/work.db"
+	`))
+	if !assert.Nil(t, e) {
+		return
+	}
+	assert.Equal(t, map[string]string{"work": "sqlite://~/work.db"}, c.Repos)
+	assert.Equal(t, 0, len(c.External))
+	uri, _ := repoURI(c, "work")
+	assert.Equal(t, "sqlite://~/work.db", uri)
+	uri, _ = repoURI(c, "default")
+	assert.Equal(t, "sqlite://~/.todo.db", uri)
+	_, e = repoURI(c, "other")
+	assert.NotNil(t, e)
+}
+
 func TestInvalidExternal(t *testing.T) {
 	_, e := readConfigToml(strings.NewReader(`
 	repo = "repo"
@@ -72,3 +105,32 @@ func TestWriteState(t *testing.T) {
 	}
 	assert.Equal(t, "[Mapping]\n  0 = \"1\"\n", bs.String())
 }
+
+func TestTomlNested(t *testing.T) {
+	c, e := readConfigToml(strings.NewReader(`
+	[jira]
+	uri = "uri"
+	type = "jira"
+
+	[jira.field.prio]
+	remote = "priority"
+
+	[jira.field.prio.values]
+	1 = "High"
+	`))
+	if !assert.Nil(t, e) {
+		return
+	}
+	assert.Equal(t, map[string]string{
+		"field.prio.remote":   "priority",
+		"field.prio.values.1": "High",
+	}, c.External[0].Extra)
+
+	_, e = readConfigToml(strings.NewReader(`
+	[jira]
+	uri = "uri"
+	type = "jira"
+	limit = 10
+	`))
+	assert.NotNil(t, e)
+}
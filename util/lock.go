@@ -0,0 +1,11 @@
+package util
+
+import "errors"
+
+// ErrorLocked returned by TryLock when another process holds the lock
+var ErrorLocked = errors.New("Lock is held by another process")
+
+// Lock an advisory inter process lock
+type Lock interface {
+	Unlock() error
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "todo.lock")
+
+	lock, err := TryLock(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	_, err = TryLock(path)
+	assert.Equal(t, ErrorLocked, err)
+
+	assert.Nil(t, lock.Unlock())
+	lock, err = TryLock(path)
+	if assert.Nil(t, err) {
+		lock.Unlock()
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+
+	assert.Nil(t, WriteFile(path, []byte("first"), 0660))
+	assert.Nil(t, WriteFile(path, []byte("second"), 0660))
+	bs, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "second", string(bs))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files))
+}
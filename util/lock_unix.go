@@ -0,0 +1,33 @@
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+type flock struct {
+	f *os.File
+}
+
+// TryLock take an advisory lock on path without waiting
+func TryLock(path string) (Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrorLocked
+		}
+		return nil, err
+	}
+	return &flock{f}, nil
+}
+
+func (l *flock) Unlock() error {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
@@ -0,0 +1,27 @@
+// +build windows
+
+package util
+
+import "os"
+
+type fileLock struct {
+	path string
+}
+
+// TryLock take an advisory lock on path without waiting, a lock left by a
+// crashed process has to be removed manually
+func TryLock(path string) (Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0660)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrorLocked
+		}
+		return nil, err
+	}
+	f.Close()
+	return &fileLock{path}, nil
+}
+
+func (l *fileLock) Unlock() error {
+	return os.Remove(l.path)
+}
@@ -0,0 +1,37 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetByUUIDPrefix(t *testing.T) {
+	r, v := newFake()
+
+	task := r.MustAdd("message", nil)
+	task.UUID = "0f0e3a6c-8a5b-4bb4-9f31-5cf0b5a8a1d2"
+	r.MustUpdate(task)
+
+	if got, e := v.Get("0f0e3a"); assert.Nil(t, e) {
+		assert.Equal(t, "message", got.Message)
+		assert.Equal(t, "0f0e3a", got.ID)
+	}
+	_, e := v.Get("ab")
+	assert.NotNil(t, e)
+}
+
+func TestGetByUUIDAmbiguous(t *testing.T) {
+	r, v := newFake()
+
+	t1 := r.MustAdd("message1", nil)
+	t1.UUID = "0f0e3a6c-8a5b-4bb4-9f31-5cf0b5a8a1d2"
+	r.MustUpdate(t1)
+	t2 := r.MustAdd("message2", nil)
+	t2.UUID = "0f0e3b11-8a5b-4bb4-9f31-5cf0b5a8a1d2"
+	r.MustUpdate(t2)
+
+	_, e := v.Get("0f0e3")
+	assert.Equal(t, todo.ErrorAmbiguous, e)
+}
@@ -0,0 +1,159 @@
+package view
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// recording external, assigns ids to created tasks and records the ops
+type recording struct {
+	id       string
+	ops      []ext.Op
+	comments []string
+}
+
+func (e *recording) Handle(d ext.Delta) (todo.Task, error) {
+	e.ops = append(e.ops, d.Op)
+	task := d.Task
+	if l, ok := task.Link(e.id); ok && l.ID == "" {
+		task.SetLink(e.id, todo.Link{ID: e.id + "-1"})
+	}
+	return task, nil
+}
+func (e *recording) Sync(todo.RepoBegin, bool) (ext.Plan, error) { return ext.Plan{}, nil }
+func (e *recording) Apply(todo.RepoBegin, ext.Plan) error        { return nil }
+func (e *recording) Close() error                                { return nil }
+
+func (e *recording) Comment(link todo.Link, body string) error {
+	e.comments = append(e.comments, link.ID+": "+body)
+	return nil
+}
+
+func (e *recording) Capabilities() ext.Capabilities {
+	return ext.Capabilities{Fields: []ext.FieldMap{
+		{Local: "comments", Remote: "comment", Direction: ext.DirectionPull, ReadOnly: true},
+	}}
+}
+func (e *recording) Check(bool) []ext.Diagnostic { return nil }
+
+var recorded = map[string]*recording{}
+
+func init() {
+	ext.Register("recording", func(cfg ext.ExternalConfig) (ext.External, error) {
+		recorded[cfg.ID] = &recording{id: cfg.ID}
+		return recorded[cfg.ID], nil
+	})
+}
+
+func newLinked() (*fake.Fake, Todo) {
+	r := fake.New()
+	e, _ := ext.New([]ext.ExternalConfig{
+		{Type: "recording", ID: "a", URI: "a"},
+		{Type: "recording", ID: "b", URI: "b"},
+	})
+	v, _ := New(r, e, State{})
+	task := r.MustAdd("message", nil)
+	task.SetLink("a", todo.Link{ID: "a-1"})
+	r.MustUpdate(task)
+	v.List(listAll)
+	return r, v
+}
+
+func TestMoveLink(t *testing.T) {
+	r, v := newLinked()
+
+	if _, err := v.MoveLink("0", "b", false); !assert.Nil(t, err) {
+		return
+	}
+	task := r.MustGet("0")
+	assert.True(t, task.Links["a"].Detached())
+	assert.Equal(t, "b-1", task.Links["b"].ID)
+	assert.Empty(t, recorded["a"].ops)
+	assert.Equal(t, []ext.Op{ext.OpRelink}, recorded["b"].ops)
+}
+
+func TestMoveLinkClose(t *testing.T) {
+	r, v := newLinked()
+
+	if _, err := v.MoveLink("0", "b", true); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"b"}, r.MustGet("0").Linked())
+	assert.Equal(t, []ext.Op{ext.OpDelete}, recorded["a"].ops)
+	_, err := v.MoveLink("0", "b", true)
+	assert.NotNil(t, err)
+}
+
+func TestDetach(t *testing.T) {
+	r, v := newLinked()
+
+	if !assert.Nil(t, v.Detach("0")) {
+		return
+	}
+	assert.True(t, r.MustGet("0").Links["a"].Detached())
+	assert.Empty(t, recorded["a"].ops)
+	assert.NotNil(t, v.Detach("0"))
+
+	if _, err := v.AddLink("0", "a"); !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, todo.Link{ID: "a-1"}, r.MustGet("0").Links["a"])
+	assert.Equal(t, []ext.Op{ext.OpRelink}, recorded["a"].ops)
+}
+
+func TestComment(t *testing.T) {
+	r, v := newLinked()
+
+	if !assert.Nil(t, v.Comment("0", "looks good")) {
+		return
+	}
+	assert.Equal(t, []string{"a-1: looks good"}, recorded["a"].comments)
+	assert.Equal(t, "", r.MustGet("0").Attr["note"])
+
+	r.MustAdd("local", nil)
+	v.List(listAll)
+	v.Comment("1", "first")
+	v.Comment("1", "second")
+	assert.Equal(t, "first\nsecond", r.MustGet("1").Attr["note"])
+}
+
+func TestReadOnly(t *testing.T) {
+	r, v := newLinked()
+	task := r.MustGet("0")
+	task.Attr = map[string]string{"comments": "2017-01-02 10:00 Me: read"}
+	r.MustUpdate(task)
+
+	task, _ = v.Get("0")
+	task.Attr = map[string]string{"comments": "changed"}
+	assert.NotNil(t, v.Update(task))
+	assert.Equal(t, "2017-01-02 10:00 Me: read", r.MustGet("0").Attr["comments"])
+
+	task, _ = v.Get("0")
+	task.Message = "changed"
+	assert.Nil(t, v.Update(task), "other changes are fine")
+
+	r.MustAdd("local", map[string]string{"comments": "mine"})
+	v.List(listAll)
+	task, _ = v.Get("1")
+	task.Attr["comments"] = "changed"
+	assert.Nil(t, v.Update(task), "not attached")
+}
+
+func TestTrack(t *testing.T) {
+	start := time.Date(2017, 1, 2, 10, 0, 0, 0, time.UTC)
+	task := todo.Task{State: todo.StateDoing}
+	track(todo.Task{State: todo.StateTodo}, &task, start)
+	track(task, &task, start.Add(time.Minute))
+	assert.Equal(t, "2017-01-02T10:00:00Z", task.Attr[todo.Worklog])
+
+	done := task
+	done.State = todo.StateDone
+	track(task, &done, start.Add(time.Hour))
+	assert.Equal(t, []todo.Interval{{Start: start, End: start.Add(time.Hour)}}, done.Worklog())
+	assert.Equal(t, "2017-01-02T10:00:00Z", task.Attr[todo.Worklog], "copied")
+}
@@ -2,20 +2,39 @@ package view
 
 import (
 	"sort"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/jwiklund/todo/ext"
 	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
 )
 
+var viewLog = logrus.WithField("comp", "view")
+
 // Todo a task repository view model
 type Todo interface {
 	List(filter func(todo.Task) bool) ([]todo.Task, error)
 	Add(string, map[string]string) (todo.Task, error)
 	Get(string) (todo.Task, error)
 	Update(todo.Task) error
+	Move(id, name string, target todo.Repo) (todo.Task, error)
+
+	SyncAll(dryRun bool) []ext.Result
+	Sync(name string, dryRun bool) (ext.Plan, error)
+	Apply(plans []ext.Plan) error
+	Link(add ext.PlanAction, id string) (ext.PlanAction, error)
+	AddLink(id, external string) (todo.Task, error)
+	RemoveLink(id, external string) error
+	MoveLink(id, external string, close bool) (todo.Task, error)
+	Detach(id string) error
+	Comment(id, text string) error
+	Describe(task todo.Task) []ext.Description
 
-	SyncAll(dryRun bool) error
-	Sync(name string, dryRun bool) error
+	Outbox() ([]todo.Task, error)
+	Retry() error
+	Check(name string) ([]ext.Report, error)
+	Drop(id string) error
 
 	State() State
 
@@ -55,19 +74,33 @@ func (t *view) Add(message string, attr map[string]string) (todo.Task, error) {
 	if err != nil {
 		return task, err
 	}
-	upd, err := t.ext.Handle(task)
-	if err != nil {
-		return upd, err
-	}
+	upd, err := t.push(ext.Create(task))
+	queued(err)
 	if !task.Equal(upd) {
 		return upd, t.repo.Update(upd)
 	}
 	return upd, nil
 }
 
-// Get from relative ID, return with relative id
-func (t *view) Get(id string) (todo.Task, error) {
+// toDB resolve a relative ID or uuid prefix to an absolute id
+func (t *view) toDB(id string) (string, error) {
 	aid, err := t.state.ToDB(id)
+	if err == nil {
+		return aid, nil
+	}
+	task, uerr := t.repo.GetByUUID(id)
+	if uerr == todo.ErrorNotFound {
+		return id, err
+	}
+	if uerr != nil {
+		return id, uerr
+	}
+	return task.ID, nil
+}
+
+// Get from relative ID or uuid prefix, return with the given id
+func (t *view) Get(id string) (todo.Task, error) {
+	aid, err := t.toDB(id)
 	if err != nil {
 		return todo.Task{}, err
 	}
@@ -79,18 +112,170 @@ func (t *view) Get(id string) (todo.Task, error) {
 	return raw, nil
 }
 
-// Update uses task with relative ID
+// Update uses task with relative ID or uuid prefix
 func (t *view) Update(task todo.Task) error {
-	id, err := t.state.ToDB(task.ID)
+	id, err := t.toDB(task.ID)
 	if err != nil {
 		return err
 	}
 	task.ID = id
-	mod, err := t.ext.Handle(task)
+	touch(&task)
+	prev, err := t.repo.Get(id)
+	if err != nil {
+		return err
+	}
+	for attr, external := range t.ext.ReadOnly(task) {
+		if prev.Attr[attr] != task.Attr[attr] {
+			return errors.Errorf("%s is read from %s and can not be changed", attr, external)
+		}
+	}
+	track(prev, &task, time.Now())
+	if _, ok := prev.Attr[ext.Outbox]; ok {
+		// the externals never saw prev, and may still have removed links
+		prev = ext.Replay(prev).Prev
+	}
+	upd, err := t.push(ext.Update(prev, task))
+	queued(err)
+	return t.repo.Update(upd)
+}
+
+// push task to its externals, if that fails the task is kept in the outbox
+// with what the externals that succeeded returned, and retried later
+func (t *view) push(d ext.Delta) (todo.Task, error) {
+	if _, ok := d.Task.Attr[ext.Outbox]; ok {
+		d.Task.Attr = copyAttr(d.Task.Attr)
+		delete(d.Task.Attr, ext.Outbox)
+	}
+	mod, err := t.ext.Handle(d)
+	if err != nil {
+		return ext.Queue(mod, d, err), err
+	}
+	return mod, nil
+}
+
+// queued warn that a task was kept in the outbox
+func queued(err error) {
+	if err != nil {
+		viewLog.Warnf("Could not update external, kept in outbox: %v", err)
+		viewLog.Debugf("%+v", err)
+	}
+}
+
+func copyAttr(attr map[string]string) map[string]string {
+	c := map[string]string{}
+	for key, value := range attr {
+		c[key] = value
+	}
+	return c
+}
+
+// Outbox tasks not yet written to their externals, done or not, with
+// relative ids, resets relative ids
+func (t *view) Outbox() ([]todo.Task, error) {
+	ts, err := t.repo.WithAttr(ext.Outbox)
+	if err != nil {
+		return ts, err
+	}
+	sort.Sort(sorter(ts))
+	return t.state.Remapp(ts)
+}
+
+// Retry writing tasks in the outbox to their externals
+func (t *view) Retry() error {
+	ts, err := t.repo.WithAttr(ext.Outbox)
 	if err != nil {
 		return err
 	}
-	return t.repo.Update(mod)
+	for _, task := range ts {
+		upd, err := t.push(ext.Replay(task))
+		if err != nil {
+			viewLog.Debugf("Still in outbox %s: %v", task.ID, err)
+			continue
+		}
+		if err := t.repo.Update(upd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop task with relative ID or uuid prefix from the outbox, without writing
+// it to its external
+func (t *view) Drop(id string) error {
+	aid, err := t.toDB(id)
+	if err != nil {
+		return err
+	}
+	task, err := t.repo.Get(aid)
+	if err != nil {
+		return err
+	}
+	if _, ok := task.Attr[ext.Outbox]; !ok {
+		return errors.Errorf("Task %s is not in the outbox", id)
+	}
+	delete(task.Attr, ext.Outbox)
+	return t.repo.Update(task)
+}
+
+// touch record local modification time, used to resolve sync conflicts
+func touch(task *todo.Task) {
+	if task.Attr == nil {
+		task.Attr = map[string]string{}
+	}
+	task.Attr["modified"] = time.Now().UTC().Format(time.RFC3339)
+}
+
+// track the time worked on a task, from it is started (doing) until it is
+// stopped (any other state)
+func track(prev todo.Task, task *todo.Task, now time.Time) {
+	switch {
+	case prev.State != todo.StateDoing && task.State == todo.StateDoing:
+		task.StartWork(now)
+	case prev.State == todo.StateDoing && task.State != todo.StateDoing:
+		task.StopWork(now)
+	}
+}
+
+// Move task to the target repository named name. The original is kept as a
+// done task without external links so that it is neither synced nor revived.
+func (t *view) Move(id, name string, target todo.Repo) (todo.Task, error) {
+	aid, err := t.toDB(id)
+	if err != nil {
+		return todo.Task{}, err
+	}
+	task, err := t.repo.Get(aid)
+	if err != nil {
+		return task, err
+	}
+	moved := task
+	moved.Attr = map[string]string{}
+	for key, value := range task.Attr {
+		moved.Attr[key] = value
+	}
+	existing := todo.Task{}
+	err = todo.ErrorNotFound
+	if task.UUID != "" {
+		existing, err = target.GetByUUID(task.UUID)
+	}
+	if err == nil {
+		// moved back, revive the copy left behind
+		moved.ID = existing.ID
+		delete(moved.Attr, "moved")
+		err = target.Update(moved)
+	} else if err == todo.ErrorNotFound {
+		moved, err = target.Import(moved)
+	}
+	if err != nil {
+		return moved, errors.Wrap(err, "Could not move task to "+name)
+	}
+
+	task.Links = nil
+	if task.Attr == nil {
+		task.Attr = map[string]string{}
+	}
+	task.Attr["moved"] = name
+	task.State = todo.StateDone
+	return moved, t.repo.Update(task)
 }
 
 func (t *view) Close() error {
@@ -107,14 +292,145 @@ func (t *view) Close() error {
 	return nil
 }
 
-func (t *view) Sync(name string, dryRun bool) error {
+func (t *view) Sync(name string, dryRun bool) (ext.Plan, error) {
 	return t.ext.Sync(t.repo, name, dryRun)
 }
 
-func (t *view) SyncAll(dryRun bool) error {
+func (t *view) SyncAll(dryRun bool) []ext.Result {
 	return t.ext.SyncAll(t.repo, dryRun)
 }
 
+// Check the externals or the named external
+func (t *view) Check(name string) ([]ext.Report, error) {
+	return t.ext.Check(name)
+}
+
+func (t *view) Apply(plans []ext.Plan) error {
+	return t.ext.Apply(t.repo, plans)
+}
+
+// Link a planned add to the task with relative ID or uuid prefix instead
+func (t *view) Link(add ext.PlanAction, id string) (ext.PlanAction, error) {
+	aid, err := t.toDB(id)
+	if err != nil {
+		return add, err
+	}
+	local, err := t.repo.Get(aid)
+	if err != nil {
+		return add, err
+	}
+	return add.LinkTo(local), nil
+}
+
+// AddLink link task with relative ID or uuid prefix to external, the task is
+// created in the external
+func (t *view) AddLink(id, external string) (todo.Task, error) {
+	task, err := t.Get(id)
+	if err != nil {
+		return task, err
+	}
+	if l, ok := task.Link(external); ok && l.Detached() {
+		// attach again, the external task is updated
+		task.SetLink(external, l.Attach())
+	} else if ok {
+		return task, errors.Errorf("Task %s is already linked to %s", id, external)
+	} else {
+		task.SetLink(external, todo.Link{})
+	}
+	if err := t.Update(task); err != nil {
+		return task, err
+	}
+	return t.Get(id)
+}
+
+// RemoveLink unlink task with relative ID or uuid prefix from external
+func (t *view) RemoveLink(id, external string) error {
+	task, err := t.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := task.Link(external); !ok {
+		return errors.Errorf("Task %s is not linked to %s", id, external)
+	}
+	task.Unlink(external)
+	return t.Update(task)
+}
+
+// MoveLink move task with relative ID or uuid prefix to external, the task is
+// created in external and closed in the externals it was linked to if close,
+// otherwise it is detached from them
+func (t *view) MoveLink(id, external string, close bool) (todo.Task, error) {
+	task, err := t.Get(id)
+	if err != nil {
+		return task, err
+	}
+	if task.Attached(external) {
+		return task, errors.Errorf("Task %s is already linked to %s", id, external)
+	}
+	for _, name := range task.Linked() {
+		l, _ := task.Link(name)
+		if l.Detached() {
+			continue
+		}
+		if close {
+			task.Unlink(name)
+		} else {
+			task.SetLink(name, l.Detach())
+		}
+	}
+	// attach again if detached from external before
+	l, _ := task.Link(external)
+	task.SetLink(external, l.Attach())
+	if err := t.Update(task); err != nil {
+		return task, err
+	}
+	return t.Get(id)
+}
+
+// Detach task with relative ID or uuid prefix from all its externals, it is
+// kept local and the next sync neither closes nor revives it
+func (t *view) Detach(id string) error {
+	task, err := t.Get(id)
+	if err != nil {
+		return err
+	}
+	detached := false
+	for _, name := range task.Linked() {
+		if l, _ := task.Link(name); !l.Detached() {
+			task.SetLink(name, l.Detach())
+			detached = true
+		}
+	}
+	if !detached {
+		return errors.Errorf("Task %s is not linked to any external", id)
+	}
+	return t.Update(task)
+}
+
+// Comment task with relative ID or uuid prefix in its externals, a task not
+// linked to an external that takes comments gets the comment in its note
+func (t *view) Comment(id, text string) error {
+	task, err := t.Get(id)
+	if err != nil {
+		return err
+	}
+	commented, err := t.ext.Comment(task, text)
+	if err != nil || commented {
+		return err
+	}
+	task.Attr = copyAttr(task.Attr)
+	if note := task.Attr["note"]; note != "" {
+		text = note + "\n" + text
+	}
+	task.Attr["note"] = text
+	return t.Update(task)
+}
+
+// Describe the task as its externals have it
+func (t *view) Describe(task todo.Task) []ext.Description {
+	return t.ext.Describe(task)
+}
+
 func (t *view) State() State {
 	return t.state
 }
@@ -0,0 +1,206 @@
+package view
+
+import (
+	"strings"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/pkg/errors"
+)
+
+// Named a repository with a name
+type Named struct {
+	Name string
+	Repo todo.RepoBegin
+}
+
+// Merge combine repositories into one, task ids are prefixed with the
+// repository name and new tasks are added to the first repository
+func Merge(repos []Named) todo.RepoBegin {
+	m := &multiRepo{begin: repos}
+	for _, r := range repos {
+		m.merged = append(m.merged, named{r.Name, r.Repo})
+	}
+	return m
+}
+
+type named struct {
+	name string
+	repo todo.Repo
+}
+
+// merged route operations to the named repositories
+type merged []named
+
+func splitID(id string) (string, string) {
+	indx := strings.LastIndex(id, ":")
+	if indx == -1 {
+		return "", id
+	}
+	return id[0:indx], id[indx+1:]
+}
+
+func prefix(name string, task todo.Task) todo.Task {
+	task.ID = name + ":" + task.ID
+	return task
+}
+
+func (m merged) route(id string) (todo.Repo, string, string, error) {
+	name, rid := splitID(id)
+	for _, r := range m {
+		if r.name == name {
+			return r.repo, r.name, rid, nil
+		}
+	}
+	return nil, "", id, errors.Errorf("No repo for task %s", id)
+}
+
+func (m merged) List() ([]todo.Task, error) {
+	var res []todo.Task
+	for _, r := range m {
+		ts, err := r.repo.List()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list "+r.name)
+		}
+		for _, t := range ts {
+			res = append(res, prefix(r.name, t))
+		}
+	}
+	return res, nil
+}
+
+func (m merged) WithAttr(key string) ([]todo.Task, error) {
+	var res []todo.Task
+	for _, r := range m {
+		ts, err := r.repo.WithAttr(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not list "+r.name)
+		}
+		for _, t := range ts {
+			res = append(res, prefix(r.name, t))
+		}
+	}
+	return res, nil
+}
+
+func (m merged) Add(message string, attr map[string]string) (todo.Task, error) {
+	t, err := m[0].repo.Add(message, attr)
+	return prefix(m[0].name, t), err
+}
+
+func (m merged) Import(task todo.Task) (todo.Task, error) {
+	t, err := m[0].repo.Import(task)
+	return prefix(m[0].name, t), err
+}
+
+func (m merged) Get(id string) (todo.Task, error) {
+	r, name, rid, err := m.route(id)
+	if err != nil {
+		return todo.Task{}, err
+	}
+	t, err := r.Get(rid)
+	return prefix(name, t), err
+}
+
+func (m merged) GetByUUID(uuid string) (todo.Task, error) {
+	return m.find(func(r todo.Repo) (todo.Task, error) {
+		return r.GetByUUID(uuid)
+	})
+}
+
+func (m merged) GetByExternal(repo, extID string) (todo.Task, error) {
+	return m.find(func(r todo.Repo) (todo.Task, error) {
+		return r.GetByExternal(repo, extID)
+	})
+}
+
+// find a single task in any repository, the done task left behind by a move
+// gives way to the task moved to another repository
+func (m merged) find(get func(todo.Repo) (todo.Task, error)) (todo.Task, error) {
+	var found, live []todo.Task
+	for _, r := range m {
+		t, e := get(r.repo)
+		if e == todo.ErrorNotFound {
+			continue
+		}
+		if e != nil {
+			return todo.Task{}, e
+		}
+		found = append(found, prefix(r.name, t))
+		if t.State != todo.StateDone || t.Attr["moved"] == "" {
+			live = append(live, prefix(r.name, t))
+		}
+	}
+	if len(found) == 0 {
+		return todo.Task{}, todo.ErrorNotFound
+	}
+	if len(found) == 1 {
+		return found[0], nil
+	}
+	if len(live) == 1 {
+		return live[0], nil
+	}
+	return todo.Task{}, todo.ErrorAmbiguous
+}
+
+func (m merged) Update(task todo.Task) error {
+	r, _, rid, err := m.route(task.ID)
+	if err != nil {
+		return err
+	}
+	task.ID = rid
+	return r.Update(task)
+}
+
+// Meta of the first repo
+func (m merged) Meta(key string) (string, error) {
+	return m[0].repo.Meta(key)
+}
+
+// SetMeta of the first repo
+func (m merged) SetMeta(key, value string) error {
+	return m[0].repo.SetMeta(key, value)
+}
+
+func (m merged) Close() error {
+	var e error
+	for _, r := range m {
+		if err := r.repo.Close(); err != nil && e == nil {
+			e = err
+		}
+	}
+	return e
+}
+
+type multiRepo struct {
+	merged
+	begin []Named
+}
+
+// Begin a transaction in each repository, they are committed one at a time
+func (m *multiRepo) Begin() (todo.RepoCommit, error) {
+	tx := &multiTx{}
+	for _, r := range m.begin {
+		c, err := r.Repo.Begin()
+		if err != nil {
+			tx.Close()
+			return nil, err
+		}
+		tx.merged = append(tx.merged, named{r.Name, c})
+		tx.commits = append(tx.commits, c)
+	}
+	return tx, nil
+}
+
+type multiTx struct {
+	merged
+	commits []todo.RepoCommit
+}
+
+func (m *multiTx) Commit() error {
+	for i, c := range m.commits {
+		if err := c.Commit(); err != nil {
+			return errors.Wrap(err, "Could not commit "+m.merged[i].name)
+		}
+	}
+	return nil
+}
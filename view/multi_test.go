@@ -0,0 +1,95 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMulti() (*fake.Fake, *fake.Fake, Todo) {
+	work := fake.New()
+	home := fake.New()
+	e, _ := ext.New(nil)
+	v, _ := New(Merge([]Named{{"work", work}, {"home", home}}), e, State{})
+	return work, home, v
+}
+
+func TestMultiList(t *testing.T) {
+	work, home, v := newMulti()
+	work.Add("work", nil)
+	home.Add("home", map[string]string{"prio": "1"})
+
+	ts, e := v.List(listAll)
+	if !assert.Nil(t, e) {
+		return
+	}
+	assert.Equal(t, []string{"home", "work"}, messages(ts))
+	assert.Equal(t, "home:0", ts[0].ID)
+	assert.Equal(t, "work:0", ts[1].ID)
+}
+
+func TestMultiUpdate(t *testing.T) {
+	work, home, v := newMulti()
+	work.Add("work", nil)
+	home.Add("home", nil)
+	v.List(listAll)
+
+	task, e := v.Get("home:0")
+	if !assert.Nil(t, e) {
+		return
+	}
+	task.State = todo.StateDone
+	assert.Nil(t, v.Update(task))
+	assert.Equal(t, todo.StateDone, home.MustGet("0").State)
+	assert.Equal(t, todo.StateTodo, work.MustGet("0").State)
+}
+
+func TestMultiAdd(t *testing.T) {
+	work, _, v := newMulti()
+	task, e := v.Add("message", nil)
+	if assert.Nil(t, e) {
+		assert.Equal(t, "work:0", task.ID)
+		assert.Equal(t, "message", work.MustGet("0").Message)
+	}
+}
+
+func TestMove(t *testing.T) {
+	r, v := newFake()
+	task := r.MustAdd("message", nil)
+	task.UUID = "u1"
+	task.SetLink("text", todo.Link{ID: "1"})
+	r.MustUpdate(task)
+	v.List(listAll)
+	target := fake.New()
+
+	moved, e := v.Move("0", "work", target)
+	if !assert.Nil(t, e) {
+		return
+	}
+	assert.Equal(t, "u1", moved.UUID)
+	assert.Equal(t, []string{"text"}, target.MustGet("0").Linked())
+	assert.Equal(t, todo.StateDone, r.MustGet("0").State)
+	assert.Equal(t, map[string]string{"moved": "work"}, r.MustGet("0").Attr)
+	assert.Empty(t, r.MustGet("0").Links)
+}
+
+func TestMultiMoveGetByUUID(t *testing.T) {
+	work, home, v := newMulti()
+	task := work.MustAdd("message", nil)
+	task.UUID = "0f0e3a6c-8a5b-4bb4-9f31-5cf0b5a8a1d2"
+	work.MustUpdate(task)
+	v.List(listAll)
+
+	if _, e := v.Move("work:0", "home", home); !assert.Nil(t, e) {
+		return
+	}
+	got, e := v.Get("0f0e3a")
+	if assert.Nil(t, e) {
+		assert.Equal(t, "message", got.Message)
+		assert.Equal(t, todo.StateTodo, got.State)
+	}
+	assert.Equal(t, todo.StateDone, work.MustGet("0").State)
+}
@@ -0,0 +1,205 @@
+package view
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/jwiklund/todo/ext"
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/todo/fake"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type flaky struct {
+	down    bool
+	deleted []string
+}
+
+func (f *flaky) Handle(d ext.Delta) (todo.Task, error) {
+	task := d.Task
+	if d.Op == ext.OpDelete {
+		if f.down {
+			return task, errors.New("unreachable")
+		}
+		l, _ := d.Prev.Link("remote")
+		f.deleted = append(f.deleted, l.ID)
+		return task, nil
+	}
+	if _, ok := task.Link("remote"); !ok {
+		return task, nil
+	}
+	if f.down {
+		return task, errors.New("unreachable")
+	}
+	task.SetLink("remote", todo.Link{ID: "R-1"})
+	return task, nil
+}
+func (f *flaky) Sync(todo.RepoBegin, bool) (ext.Plan, error) { return ext.Plan{}, nil }
+func (f *flaky) Apply(todo.RepoBegin, ext.Plan) error        { return nil }
+func (f *flaky) Close() error                                { return nil }
+
+// counting an external that never fails, counting the tasks it created
+type counting struct {
+	created int
+}
+
+func (c *counting) Handle(d ext.Delta) (todo.Task, error) {
+	task := d.Task
+	if l, ok := task.Link("a"); ok && l.ID == "" {
+		c.created++
+		task.SetLink("a", todo.Link{ID: "A-" + strconv.Itoa(c.created)})
+	}
+	return task, nil
+}
+func (c *counting) Sync(todo.RepoBegin, bool) (ext.Plan, error) { return ext.Plan{}, nil }
+func (c *counting) Apply(todo.RepoBegin, ext.Plan) error        { return nil }
+func (c *counting) Close() error                                { return nil }
+
+var remote = &flaky{}
+var local = &counting{}
+
+func init() {
+	ext.Register("flaky", func(ext.ExternalConfig) (ext.External, error) {
+		return remote, nil
+	})
+	ext.Register("counting", func(ext.ExternalConfig) (ext.External, error) {
+		return local, nil
+	})
+}
+
+func newFlaky() (*fake.Fake, Todo) {
+	r := fake.New()
+	e, _ := ext.New([]ext.ExternalConfig{
+		{Type: "flaky", ID: "remote", URI: "flaky"},
+		{Type: "counting", ID: "a", URI: "counting"},
+	})
+	v, _ := New(r, e, State{})
+	*remote = flaky{}
+	*local = counting{}
+	return r, v
+}
+
+func reason(task todo.Task) string {
+	p, _ := ext.Queued(task)
+	return p.Reason
+}
+
+func TestOutboxAdd(t *testing.T) {
+	r, v := newFlaky()
+	remote.down = true
+
+	v.Add("message", nil)
+	v.List(func(todo.Task) bool { return true })
+	_, err := v.AddLink("0", "remote")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "unreachable", reason(r.MustGet("0")))
+
+	remote.down = false
+	if !assert.Nil(t, v.Retry()) {
+		return
+	}
+	task := r.MustGet("0")
+	assert.Equal(t, "R-1", task.Links["remote"].ID)
+	_, pending := task.Attr[ext.Outbox]
+	assert.False(t, pending)
+}
+
+func TestOutboxDrop(t *testing.T) {
+	r, v := newFlaky()
+	remote.down = true
+
+	v.Add("message", nil)
+	v.List(func(todo.Task) bool { return true })
+	v.AddLink("0", "remote")
+
+	if !assert.Nil(t, v.Drop("0")) {
+		return
+	}
+	_, pending := r.MustGet("0").Attr[ext.Outbox]
+	assert.False(t, pending)
+	assert.NotNil(t, v.Drop("0"))
+}
+
+func TestOutboxDone(t *testing.T) {
+	r, v := newFlaky()
+	v.Add("message", nil)
+	v.List(func(todo.Task) bool { return true })
+	v.AddLink("0", "remote")
+
+	remote.down = true
+	task, _ := v.Get("0")
+	task.State = todo.StateDone
+	if !assert.Nil(t, v.Update(task)) {
+		return
+	}
+	ts, err := v.Outbox()
+	if !assert.Nil(t, err) || !assert.Equal(t, 1, len(ts)) {
+		return
+	}
+	assert.Equal(t, todo.StateDone, ts[0].State)
+
+	remote.down = false
+	if !assert.Nil(t, v.Retry()) {
+		return
+	}
+	_, pending := r.MustGet("0").Attr[ext.Outbox]
+	assert.False(t, pending)
+}
+
+func TestOutboxDelete(t *testing.T) {
+	r, v := newFlaky()
+	v.Add("message", nil)
+	v.List(func(todo.Task) bool { return true })
+	v.AddLink("0", "remote")
+
+	remote.down = true
+	if !assert.Nil(t, v.RemoveLink("0", "remote")) {
+		return
+	}
+	p, pending := ext.Queued(r.MustGet("0"))
+	if !assert.True(t, pending) {
+		return
+	}
+	assert.Equal(t, "R-1", p.Removed["remote"].ID)
+
+	// still removed after another change
+	task, _ := v.Get("0")
+	task.Message = "changed"
+	v.Update(task)
+
+	remote.down = false
+	if !assert.Nil(t, v.Retry()) {
+		return
+	}
+	assert.Equal(t, []string{"R-1"}, remote.deleted)
+	_, pending = r.MustGet("0").Attr[ext.Outbox]
+	assert.False(t, pending)
+}
+
+func TestOutboxPartial(t *testing.T) {
+	r, v := newFlaky()
+	remote.down = true
+	v.Add("message", nil)
+	v.List(func(todo.Task) bool { return true })
+	task, _ := v.Get("0")
+	task.SetLink("a", todo.Link{})
+	task.SetLink("remote", todo.Link{})
+	if !assert.Nil(t, v.Update(task)) {
+		return
+	}
+	kept := r.MustGet("0")
+	assert.Equal(t, "A-1", kept.Links["a"].ID, "what a returned is kept")
+	assert.Equal(t, "unreachable", reason(kept))
+
+	remote.down = false
+	if !assert.Nil(t, v.Retry()) {
+		return
+	}
+	task = r.MustGet("0")
+	assert.Equal(t, 1, local.created)
+	assert.Equal(t, "A-1", task.Links["a"].ID)
+	assert.Equal(t, "R-1", task.Links["remote"].ID)
+}
@@ -33,7 +33,8 @@ func (s sorter) Less(i, j int) bool {
 }
 
 func id(t todo.Task) int {
-	if i, err := strconv.Atoi(t.ID); err == nil {
+	_, rid := splitID(t.ID)
+	if i, err := strconv.Atoi(rid); err == nil {
 		return i
 	}
 	return 0
@@ -25,9 +25,16 @@ func (s *State) ToDB(id string) (string, error) {
 func (s *State) Remapp(tasks []todo.Task) ([]todo.Task, error) {
 	r := make([]todo.Task, len(tasks))
 	s.Mapping = map[string]string{}
+	// tasks from merged repos are numbered per repo, prefixed by repo name
+	counts := map[string]int{}
 	for i, task := range tasks {
 		r[i] = task
-		relID := strconv.Itoa(i)
+		name, _ := splitID(task.ID)
+		relID := strconv.Itoa(counts[name])
+		counts[name]++
+		if name != "" {
+			relID = name + ":" + relID
+		}
 		s.Mapping[relID] = r[i].ID
 		r[i].ID = relID
 	}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jwiklund/todo/todo"
+	"github.com/jwiklund/todo/view"
+)
+
+// todo [-v][-r <repo>] worklog <id>
+func worklogCmd(t view.Todo, opts map[string]interface{}) {
+	task, err := t.Get(opts["<id>"].(string))
+	if err != nil {
+		mainLog.Error(err.Error())
+		mainLog.Debugf("%+v", err)
+		return
+	}
+	renderWorklog(task, os.Stdout)
+}
+
+// renderWorklog the intervals worked on task, where each was logged and the
+// total
+func renderWorklog(task todo.Task, out io.Writer) {
+	w := tabwriter.NewWriter(out, 6, 8, 2, ' ', 0)
+	var total time.Duration
+	for _, i := range task.Worklog() {
+		total += i.Duration()
+		end := "working"
+		if i.Done() {
+			end = i.End.Local().Format("15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", i.Start.Local().Format("2006-01-02 15:04"), end,
+			i.Duration().Round(time.Minute), logged(task, i))
+	}
+	fmt.Fprintf(w, "total\t\t%s\n", total.Round(time.Minute))
+	w.Flush()
+}
+
+// logged the externals interval i was logged in, pending if linked but not
+// logged yet
+func logged(task todo.Task, i todo.Interval) string {
+	var res []string
+	for _, name := range task.Linked() {
+		if l, _ := task.Link(name); l.Logged(i) {
+			res = append(res, name)
+		}
+	}
+	if len(res) == 0 && i.Done() && len(task.Linked()) > 0 {
+		return "pending"
+	}
+	return strings.Join(res, " ")
+}